@@ -0,0 +1,43 @@
+package gt
+
+import "fmt"
+
+// Rendering errors, returned by *Universe.RenderE(), could be inspected with errors.As().
+// Location is the rules path and the Go source position of the rule, it is empty for the rendered template itself.
+type (
+	// MissingParamError is returned, when the param, required by the rule, is not provided.
+	MissingParamError struct {
+		Rule     string // rule description, for example: "text injection"
+		Key      string
+		Location string
+	}
+	// ParamTypeError is returned, when the provided param has the type the rule can't use.
+	ParamTypeError struct {
+		Rule     string
+		Key      string
+		Expected string // expected type description, for example: "a map or a struct"
+		Value    interface{}
+		Location string
+	}
+	// UnknownTemplateError is returned, when the rendered, placed or injected template doesn't exist.
+	UnknownTemplateError struct {
+		Name     string
+		Location string
+	}
+)
+
+func (e *MissingParamError) Error() string {
+	return withLocation(fmt.Sprintf("%s \"%s\" not provided", e.Rule, e.Key), e.Location)
+}
+func (e *ParamTypeError) Error() string {
+	return withLocation(fmt.Sprintf("%s \"%s\" should be %s, got: %T", e.Rule, e.Key, e.Expected, e.Value), e.Location)
+}
+func (e *UnknownTemplateError) Error() string {
+	return withLocation(fmt.Sprintf("template \"%s\" not found", e.Name), e.Location)
+}
+func withLocation(msg, at string) string {
+	if len(at) == 0 {
+		return msg
+	}
+	return msg + " at " + at
+}
@@ -0,0 +1,153 @@
+package gt
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// SafeHTML is a trusted HTML fragment, which is placed by TextInj() as is.
+	SafeHTML string
+	// escapeContext is a place within the document, where the text is placed, it defines the escaping.
+	escapeContext uint8
+)
+
+const (
+	textContext      escapeContext = iota // text within HTML element
+	attributeContext                      // quoted attribute value
+	scriptContext                         // string literal within <script> element
+	styleContext                          // value within <style> element
+)
+
+// attributes, which values are URLs, so the values are filtered by URL scheme.
+var urlAttributes = []string{
+	"action",
+	"formaction",
+	"href",
+	"src",
+}
+
+// URL schemes, which are allowed for URL-bearing attributes, URLs without scheme (relative) are allowed too.
+var safeURLSchemes = []string{
+	"http",
+	"https",
+	"mailto",
+	"tel",
+}
+
+// replaces URLs with unsafe schemes, like "javascript:".
+const unsafeURL = "about:invalid#unsafe-url"
+
+var htmlReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&#34;", "'", "&#39;")
+
+// raw text elements, their content is not HTML, so it is escaped differently.
+var rawTextContexts = map[string]escapeContext{
+	"script": scriptContext,
+	"style":  styleContext,
+}
+
+// escapes the text for the given context.
+func escape(ctx escapeContext, v string) string {
+	switch ctx {
+	case scriptContext:
+		return escapeScript(v)
+	case styleContext:
+		return escapeStyle(v)
+	default:
+		return htmlReplacer.Replace(v)
+	}
+}
+
+// escapes the text, provided by the template author.
+// Within <script> and <style> elements it is code, so only closing tags are escaped to keep the element intact.
+func escapeStatic(ctx escapeContext, v string) string {
+	switch ctx {
+	case scriptContext, styleContext:
+		return strings.ReplaceAll(v, "</", "<\\/")
+	default:
+		return htmlReplacer.Replace(v)
+	}
+}
+
+// escapes the text for JavaScript string literal, it is also safe for HTML parser.
+func escapeScript(v string) string {
+	var sb strings.Builder
+	for _, c := range v {
+		switch c {
+		case '\\':
+			sb.WriteString("\\\\")
+		case '\'':
+			sb.WriteString("\\'")
+		case '"':
+			sb.WriteString("\\\"")
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case '\t':
+			sb.WriteString("\\t")
+		case '<', '>', '&', '`', '\u2028', '\u2029':
+			sb.WriteString(fmt.Sprintf("\\u%04X", c))
+		default:
+			if c < 0x20 {
+				sb.WriteString(fmt.Sprintf("\\u%04X", c))
+				continue
+			}
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// escapes the text for CSS value, only alphanumeric and a few harmless characters are kept as is.
+func escapeStyle(v string) string {
+	var sb strings.Builder
+	for _, c := range v {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c >= 0x80:
+			sb.WriteRune(c)
+		case strings.ContainsRune(" #%,-._", c):
+			sb.WriteRune(c)
+		default:
+			sb.WriteString(fmt.Sprintf("\\%X ", c))
+		}
+	}
+	return sb.String()
+}
+
+func urlAttribute(n string) bool {
+	n = strings.ToLower(n)
+	for _, a := range urlAttributes {
+		if a == n {
+			return true
+		}
+	}
+	return false
+}
+
+// checks whether the URL is relative or has a safe scheme.
+func safeURL(u string) bool {
+	// browsers ignore leading spaces and control characters, and tabs and new lines within the URL
+	u = strings.TrimLeft(u, "\x00\x01\x02\x03\x04\x05\x06\x07\x08\x09\x0a\x0b\x0c\x0d\x0e\x0f\x10\x11\x12\x13\x14\x15\x16\x17\x18\x19\x1a\x1b\x1c\x1d\x1e\x1f\x20")
+	u = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(u)
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true // relative URL
+	}
+	scheme := strings.ToLower(u[:i])
+	for _, s := range safeURLSchemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// escapes injected attribute value, values of URL-bearing attributes with unsafe schemes are replaced.
+// returns false, when the value was replaced.
+func escapeAttributeValue(name, v string) (string, bool) {
+	if urlAttribute(name) && !safeURL(v) {
+		return unsafeURL, false
+	}
+	return escape(attributeContext, v), true
+}
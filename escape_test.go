@@ -0,0 +1,92 @@
+package gt_test
+
+import (
+	. "github.com/Contra-Culture/gt"
+	"github.com/Contra-Culture/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("escaping", func() {
+	It("escapes injected attribute values and filters unsafe URLs", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/link",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a",
+					Attributes(
+						AttrInjection("href", "link"),
+						AttrInjection("title", "title"),
+						OptionalAttrInjection("data-info", "info"),
+						UnsafeAttrInjection("onclick", "onclick")),
+					Content(Text("link")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/link", map[string]interface{}{
+			"link":    "/search?q=a&b=c",
+			"title":   "\"><script>alert(1)</script>",
+			"info":    "it's",
+			"onclick": "return confirm(\"sure?\")",
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a href=\"/search?q=a&amp;b=c\" title=\"&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;\" data-info=\"it&#39;s\" onclick=\"return confirm(\"sure?\")\">link</a>"))
+		for _, link := range []string{"javascript:alert(1)", " JavaScript:alert(1)", "java\tscript:alert(1)", "data:text/html,x"} {
+			rendered, r = univ.Render("/link", map[string]interface{}{
+				"link":    link,
+				"title":   "",
+				"onclick": "",
+			})
+			Expect(r.HasErrors()).To(BeFalse())
+			Expect(r.HasWarns()).To(BeTrue())
+			Expect(report.ToString(r)).To(ContainSubstring("unsafe URL in attribute \"href\" value injection \"link\" replaced"))
+			Expect(rendered).To(Equal("<a href=\"about:invalid#unsafe-url\" title=\"\" onclick=\"\">link</a>"))
+		}
+		for _, link := range []string{"https://example.com/a:b", "mailto:me@example.com", "tel:+100", "./a:b", "#top"} {
+			rendered, r = univ.Render("/link", map[string]interface{}{
+				"link":    link,
+				"title":   "",
+				"onclick": "",
+			})
+			Expect(r.HasWarns()).To(BeFalse())
+			Expect(rendered).To(ContainSubstring(link))
+		}
+	})
+	It("escapes text for the context", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("p",
+					Attributes(Attr("title", "Tom & \"Jerry\"")),
+					Content(
+						Text("Tom & 'Jerry' <3 "),
+						TextInj("text"),
+						TextInj("html"))),
+				Tag("script",
+					Attributes(),
+					Content(
+						Text("if (a < b) { var title = \""),
+						TextInj("text"),
+						Text("\"; } // </script>"))),
+				Tag("style",
+					Attributes(),
+					Content(
+						Text("p { font-family: "),
+						TextInj("font"),
+						Text("; }")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/page", map[string]interface{}{
+			"text": "\"</script><b>'&'</b>\n",
+			"html": SafeHTML("<br/>"),
+			"font": "Arial; } body { display: none",
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal(
+			"<p title=\"Tom &amp; &#34;Jerry&#34;\">Tom &amp; &#39;Jerry&#39; &lt;3 &#34;&lt;/script&gt;&lt;b&gt;&#39;&amp;&#39;&lt;/b&gt;\n<br/></p>" +
+				"<script>if (a < b) { var title = \"\\\"\\u003C/script\\u003E\\u003Cb\\u003E\\'\\u0026\\'\\u003C/b\\u003E\\n\"; } // <\\/script></script>" +
+				"<style>p { font-family: Arial\\3B  \\7D  body \\7B  display\\3A  none; }</style>"))
+	})
+})
@@ -0,0 +1,279 @@
+package gt
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Contra-Culture/report"
+)
+
+type (
+	// Formatter formats injected value into a text, formatters are registered on Limbo and referenced by names.
+	Formatter func(interface{}) (string, error)
+	// FilterFunc transforms injected value. Args are provided within filter spec after colon, separated by comma: "truncate:80".
+	// Value is nil, when the param is not provided.
+	FilterFunc func(v interface{}, args ...string) (interface{}, error)
+	// ContextFormatter is Formatter, which gets the context of *Universe.RenderContext().
+	ContextFormatter func(ctx context.Context, v interface{}) (string, error)
+	// ContextFilterFunc is FilterFunc, which gets the context of *Universe.RenderContext().
+	ContextFilterFunc func(ctx context.Context, v interface{}, args ...string) (interface{}, error)
+	// FilterChain is a list of filter specs, applied to the injected value one by one.
+	FilterChain []string
+	filter      struct { // filter spec, bound to the filter function on template compilation
+		name string
+		args []string
+		fn   ContextFilterFunc
+	}
+)
+
+// builtin filters, available for every Limbo.
+var builtinFilters = map[string]FilterFunc{
+	"default":   defaultFilter,
+	"lower":     lowerFilter,
+	"pluralize": pluralizeFilter,
+	"truncate":  truncateFilter,
+	"upper":     upperFilter,
+}
+
+func Filters(specs ...string) FilterChain {
+	return FilterChain(specs)
+}
+
+// *Limbo.Filter() registers named filter for injections filter chains.
+func (l *Limbo) Filter(name string, f FilterFunc) {
+	l.FilterContext(name, func(_ context.Context, v interface{}, args ...string) (interface{}, error) {
+		return f(v, args...)
+	})
+}
+
+// *Limbo.FilterContext() registers named filter, which gets the rendering context, for example, to fetch the data.
+func (l *Limbo) FilterContext(name string, f ContextFilterFunc) {
+	if _, exists := l.filters[name]; exists {
+		l.rn.Error("filter \"%s\" already registered", name)
+		return
+	}
+	l.filters[name] = f
+}
+
+// binds filter specs of the injection to the registered filters, all unknown filters are reported.
+func (l *Limbo) bindFilters(r report.Node, key, at string, chains []FilterChain) ([]filter, bool) {
+	filters := []filter{}
+	ok := true
+	for _, chain := range chains {
+		for _, spec := range chain {
+			f := parseFilter(spec)
+			fn, exists := l.filters[f.name]
+			if !exists {
+				r.Error("filter \"%s\" for injection \"%s\" not registered at %s", f.name, key, at)
+				ok = false
+				continue
+			}
+			f.fn = fn
+			filters = append(filters, f)
+		}
+	}
+	return filters, ok
+}
+func parseFilter(spec string) filter {
+	name, rawArgs, hasArgs := strings.Cut(spec, ":")
+	f := filter{
+		name: strings.TrimSpace(name),
+	}
+	if hasArgs {
+		f.args = strings.Split(rawArgs, ",")
+	}
+	return f
+}
+
+// returns the names of the filters in the chains.
+func filterNames(chains []FilterChain) []string {
+	names := []string{}
+	for _, chain := range chains {
+		for _, spec := range chain {
+			names = append(names, parseFilter(spec).name)
+		}
+	}
+	return names
+}
+
+// passes injected value through the filters.
+// When there are filters, the value is considered as provided if it is not nil after filtering.
+func filterValue(ctx context.Context, v interface{}, exists bool, filters []filter) (_ interface{}, _ bool, err error) {
+	if len(filters) == 0 {
+		return v, exists, nil
+	}
+	for _, f := range filters {
+		v, err = f.fn(ctx, v, f.args...)
+		if err != nil {
+			return nil, exists, fmt.Errorf("filter \"%s\" failed: %w", f.name, err)
+		}
+	}
+	return v, v != nil, nil
+}
+
+// replaces nil and empty values with the default one: "default:Untitled".
+func defaultFilter(v interface{}, args ...string) (interface{}, error) {
+	if v == nil || v == "" {
+		return strings.Join(args, ","), nil
+	}
+	return v, nil
+}
+func lowerFilter(v interface{}, args ...string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, err := formatValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(s), nil
+}
+func upperFilter(v interface{}, args ...string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	s, err := formatValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(s), nil
+}
+
+// truncates the text to the given number of characters, truncated text ends with ellipsis: "truncate:80".
+func truncateFilter(v interface{}, args ...string) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("expected max length argument, got: %#v", args)
+	}
+	max, err := strconv.Atoi(args[0])
+	if err != nil || max < 1 {
+		return nil, fmt.Errorf("max length should be a positive integer, got: \"%s\"", args[0])
+	}
+	if v == nil {
+		return nil, nil
+	}
+	s, err := formatValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if utf8.RuneCountInString(s) <= max {
+		return s, nil
+	}
+	runes := []rune(s)
+	return strings.TrimRight(string(runes[:max-1]), " ") + "…", nil
+}
+
+// returns plural suffix for the number or the length of slice or map:
+// "pluralize" gives "" or "s", "pluralize:es" gives "" or "es", "pluralize:y,ies" gives "y" or "ies".
+func pluralizeFilter(v interface{}, args ...string) (interface{}, error) {
+	singular, plural := "", "s"
+	switch len(args) {
+	case 0:
+	case 1:
+		plural = args[0]
+	case 2:
+		singular, plural = args[0], args[1]
+	default:
+		return nil, fmt.Errorf("expected at most 2 suffixes, got: %#v", args)
+	}
+	var n float64
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n = float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = rv.Float()
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n = float64(rv.Len())
+	default:
+		return nil, fmt.Errorf("expected number, slice or map, got: %T", v)
+	}
+	if n == 1 {
+		return singular, nil
+	}
+	return plural, nil
+}
+
+// *Limbo.Formatter() registers named formatter for TextInjFormat() rules.
+func (l *Limbo) Formatter(name string, f Formatter) {
+	l.FormatterContext(name, func(_ context.Context, v interface{}) (string, error) {
+		return f(v)
+	})
+}
+
+// *Limbo.FormatterContext() registers named formatter, which gets the rendering context.
+func (l *Limbo) FormatterContext(name string, f ContextFormatter) {
+	if _, exists := l.formatters[name]; exists {
+		l.rn.Error("formatter \"%s\" already registered", name)
+		return
+	}
+	l.formatters[name] = f
+}
+
+// formats injected value into a string:
+// strings, numbers, booleans, time.Time (RFC3339), fmt.Stringer and encoding.TextMarshaler values
+// and non-nil pointers to them are supported.
+func formatValue(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case SafeHTML:
+		return string(t), nil
+	case time.Time:
+		return t.Format(time.RFC3339), nil
+	case fmt.Stringer:
+		return t.String(), nil
+	case encoding.TextMarshaler:
+		text, err := t.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(text), nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.Pointer:
+		if !rv.IsNil() {
+			return formatValue(rv.Elem().Interface())
+		}
+	}
+	return "", fmt.Errorf("unsupported value type %T", v)
+}
+
+// checks whether the value could be formatted into a string without formatter.
+func formattable(v interface{}) bool {
+	switch v.(type) {
+	case string, SafeHTML, time.Time, fmt.Stringer, encoding.TextMarshaler:
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return !rv.IsNil() && formattable(rv.Elem().Interface())
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
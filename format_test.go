@@ -0,0 +1,81 @@
+package gt_test
+
+import (
+	"strings"
+
+	. "github.com/Contra-Culture/gt"
+	"github.com/Contra-Culture/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("filters", func() {
+	It("passes injected values through filter chains", func() {
+		limbo := newLimbo()
+		limbo.Filter("reverse", func(v interface{}, args ...string) (interface{}, error) {
+			s, _ := v.(string)
+			runes := []rune(s)
+			for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+				runes[i], runes[j] = runes[j], runes[i]
+			}
+			return string(runes), nil
+		})
+		limbo.Template(
+			"/article",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("article",
+					Attributes(
+						AttrInjection("data-kind", "kind", Filters("lower")),
+						OptionalAttrInjection("title", "hint", Filters("default:No hint"))),
+					Content(
+						Tag("h1", Attributes(), Content(TextInj("title", Filters("default:Untitled", "truncate:12", "upper")))),
+						TextInj("comments"), Text(" comment"), TextInj("comments", Filters("pluralize")),
+						Text(", "),
+						TextInj("replies"), Text(" repl"), TextInj("replies", Filters("pluralize:y,ies")),
+						Text(", "),
+						TextInj("code", Filters("reverse"))))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/article", map[string]interface{}{
+			"kind":     "NEWS",
+			"title":    "Filters are applied one by one",
+			"comments": 1,
+			"replies":  2,
+			"code":     "<abc>",
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<article data-kind=\"news\" title=\"No hint\"><h1>FILTERS ARE…</h1>1 comment, 2 replies, &gt;cba&lt;</article>"))
+		rendered, r = univ.Render("/article", map[string]interface{}{
+			"kind":     "news",
+			"hint":     "Hint",
+			"comments": 0,
+			"replies":  1,
+			"code":     "",
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<article data-kind=\"news\" title=\"Hint\"><h1>UNTITLED</h1>0 comments, 1 reply, </article>"))
+		_, r = univ.Render("/article", map[string]interface{}{
+			"kind":     "news",
+			"comments": "many",
+			"replies":  0,
+			"code":     "",
+		})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"comments\": filter \"pluralize\" failed: expected number, slice or map, got: string"))
+		schema, _ := univ.Schema("/article")
+		Expect(schema.Params[1]).To(Equal(Param{Key: "hint", Kind: AttrParam, Optional: true, Filters: []string{"default"}}))
+	})
+	It("reports unknown filters on universe creation", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/article",
+			WithStylesheet("main"),
+			WithContent(TextInj("title", Filters("capitalize", "truncate:80", "slugify"))))
+		_, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(And(
+			ContainSubstring("filter \"capitalize\" for injection \"title\" not registered"),
+			ContainSubstring("filter \"slugify\" for injection \"title\" not registered")))
+		Expect(strings.Count(report.ToString(r), "not registered")).To(Equal(2))
+	})
+})
@@ -0,0 +1,137 @@
+package gt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type (
+	NodeKind string
+	EdgeKind string
+	// Graph describes dependencies between templates, stylesheets and styling templates of the universe.
+	Graph struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}
+	// GraphNode is a template, a stylesheet or a styling template, its ID is unique within the graph.
+	GraphNode struct {
+		ID   string   `json:"id"`
+		Kind NodeKind `json:"kind"`
+		Name string   `json:"name"`
+	}
+	// GraphEdge is a usage of the node To by the node From.
+	GraphEdge struct {
+		From        string   `json:"from"`
+		To          string   `json:"to"`
+		Kind        EdgeKind `json:"kind"`
+		Conditional bool     `json:"conditional,omitempty"` // true, when the template is placed by the condition, repeatable, variant, switch or injection
+	}
+)
+
+const (
+	TemplateNode        NodeKind = "template"
+	StylesheetNode      NodeKind = "stylesheet"
+	StylingTemplateNode NodeKind = "styling-template"
+)
+
+const (
+	PlacementEdge       EdgeKind = "placement"        // template placement
+	VariantEdge         EdgeKind = "variant"          // variant default or variant template
+	SwitchEdge          EdgeKind = "switch"           // switch case template
+	InjectionEdge       EdgeKind = "injection"        // template, allowed for the injection
+	StylesheetEdge      EdgeKind = "stylesheet"       // template stylesheet
+	StylingTemplateEdge EdgeKind = "styling-template" // styling template, used by the class rule
+)
+
+// returns graph node ID, unique for the nodes of different kinds with the same name.
+func nodeID(kind NodeKind, name string) string {
+	return fmt.Sprintf("%s:%s", kind, name)
+}
+
+// *Universe.Dependencies() returns dependencies graph, collected on templates compilation.
+// Nodes and edges are sorted, so the graph is the same for the same universe.
+func (u *Universe) Dependencies() *Graph {
+	g := &Graph{
+		Nodes: []GraphNode{},
+		Edges: []GraphEdge{},
+	}
+	nodes := map[string]bool{}
+	addNode := func(kind NodeKind, name string) string {
+		id := nodeID(kind, name)
+		if !nodes[id] {
+			nodes[id] = true
+			g.Nodes = append(g.Nodes, GraphNode{ID: id, Kind: kind, Name: name})
+		}
+		return id
+	}
+	edges := map[GraphEdge]bool{}
+	addEdge := func(e GraphEdge) {
+		if !edges[e] {
+			edges[e] = true
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	for _, t := range u.templates {
+		from := addNode(TemplateNode, t.name)
+		if len(t.stylesheet) > 0 {
+			addEdge(GraphEdge{From: from, To: addNode(StylesheetNode, t.stylesheet), Kind: StylesheetEdge})
+		}
+		for _, n := range t.stylingTemplates {
+			addEdge(GraphEdge{From: from, To: addNode(StylingTemplateNode, n), Kind: StylingTemplateEdge})
+		}
+		for _, ref := range t.references {
+			addEdge(GraphEdge{From: from, To: addNode(TemplateNode, ref.name), Kind: ref.kind, Conditional: ref.guarded})
+		}
+	}
+	for n := range u.stylesheets {
+		addNode(StylesheetNode, n)
+	}
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		switch {
+		case a.From != b.From:
+			return a.From < b.From
+		case a.To != b.To:
+			return a.To < b.To
+		case a.Kind != b.Kind:
+			return a.Kind < b.Kind
+		}
+		return !a.Conditional && b.Conditional
+	})
+	return g
+}
+
+// *Graph.DOT() returns the graph in Graphviz DOT format, conditional edges are dashed.
+func (g *Graph) DOT() string {
+	var sb strings.Builder
+	sb.WriteString("digraph dependencies {\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		switch n.Kind {
+		case StylesheetNode:
+			shape = "ellipse"
+		case StylingTemplateNode:
+			shape = "note"
+		}
+		fmt.Fprintf(&sb, "\t%q [label=%q, shape=%s];\n", n.ID, n.Name, shape)
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Conditional {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(&sb, "\t%q -> %q [label=%q%s];\n", e.From, e.To, e.Kind, style)
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// *Graph.JSON() returns the graph in JSON format.
+func (g *Graph) JSON() ([]byte, error) {
+	return json.Marshal(g)
+}
@@ -0,0 +1,68 @@
+package gt_test
+
+import (
+	"encoding/json"
+
+	. "github.com/Contra-Culture/gt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("dependencies", func() {
+	It("returns dependencies graph of templates and stylesheets", func() {
+		limbo := newLimbo()
+		limbo.Stylesheet(
+			"main",
+			Styling(
+				"card",
+				StylingRule(
+					[]interface{}{SelectorInjection{Name: SELF_CLASS_PLACEMENT}},
+					[][]string{{"padding", "1rem"}})))
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("div", Attributes(Class("card", "card", nil)), Content(
+					TemplatePlacement("/header", "header"),
+					TemplatePlacement("/header", "subheader"),
+					Variant("/empty", map[string]string{"widget": "/widget"}),
+					TemplateInjection("sidebar", "/widget")))))
+		limbo.Template("/header", WithStylesheet("main"), WithContent(Text("header")))
+		limbo.Template("/empty", WithStylesheet("main"), WithContent(Text("empty")))
+		limbo.Template("/widget", WithStylesheet("print"), WithContent(Text("widget")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		graph := univ.Dependencies()
+		Expect(graph.Nodes).To(Equal([]GraphNode{
+			{ID: "stylesheet:main", Kind: StylesheetNode, Name: "main"},
+			{ID: "stylesheet:print", Kind: StylesheetNode, Name: "print"},
+			{ID: "styling-template:card", Kind: StylingTemplateNode, Name: "card"},
+			{ID: "template:/empty", Kind: TemplateNode, Name: "/empty"},
+			{ID: "template:/header", Kind: TemplateNode, Name: "/header"},
+			{ID: "template:/page", Kind: TemplateNode, Name: "/page"},
+			{ID: "template:/widget", Kind: TemplateNode, Name: "/widget"},
+		}))
+		Expect(graph.Edges).To(Equal([]GraphEdge{
+			{From: "template:/empty", To: "stylesheet:main", Kind: StylesheetEdge},
+			{From: "template:/header", To: "stylesheet:main", Kind: StylesheetEdge},
+			{From: "template:/page", To: "stylesheet:main", Kind: StylesheetEdge},
+			{From: "template:/page", To: "styling-template:card", Kind: StylingTemplateEdge},
+			{From: "template:/page", To: "template:/empty", Kind: VariantEdge, Conditional: true},
+			{From: "template:/page", To: "template:/header", Kind: PlacementEdge},
+			{From: "template:/page", To: "template:/widget", Kind: InjectionEdge, Conditional: true},
+			{From: "template:/page", To: "template:/widget", Kind: VariantEdge, Conditional: true},
+			{From: "template:/widget", To: "stylesheet:print", Kind: StylesheetEdge},
+		}))
+		dot := graph.DOT()
+		Expect(dot).To(HavePrefix("digraph dependencies {\n"))
+		Expect(dot).To(ContainSubstring("\t\"template:/page\" [label=\"/page\", shape=box];\n"))
+		Expect(dot).To(ContainSubstring("\t\"stylesheet:main\" [label=\"main\", shape=ellipse];\n"))
+		Expect(dot).To(ContainSubstring("\t\"template:/page\" -> \"template:/header\" [label=\"placement\"];\n"))
+		Expect(dot).To(ContainSubstring("\t\"template:/page\" -> \"template:/empty\" [label=\"variant\", style=dashed];\n"))
+		data, err := graph.JSON()
+		Expect(err).NotTo(HaveOccurred())
+		var decoded Graph
+		Expect(json.Unmarshal(data, &decoded)).To(Succeed())
+		Expect(&decoded).To(Equal(graph))
+	})
+})
@@ -34,6 +34,21 @@ type (
 		stylesheetName string
 		content        interface{}
 		rn             report.Node
+		fills          map[string]TagContent  // slots content, resolved from the extension chain on universe creation
+		filledSlots    map[string]bool        // slots, which are actually placed by the layout
+		props          map[string]interface{} // params defaults
+	}
+	// TemplateProp is a default value of the template param.
+	TemplateProp struct {
+		key   string
+		value interface{}
+	}
+	// StaticProps are params values, bound to the template placement on template definition.
+	StaticProps map[string]interface{}
+	// SlotFill provides content for the layout's slot.
+	SlotFill struct {
+		slot    string
+		content TagContent
 	}
 	Limbo struct {
 		reportCreator    func(string, ...interface{}) report.Node
@@ -41,26 +56,44 @@ type (
 		templates        []LimboTemplate
 		stylesheets      map[string]Stylesheet
 		stylingTemplates map[string]StylingTemplate
+		formatters       map[string]ContextFormatter
+		filters          map[string]ContextFilterFunc
+		maxDepth         int
 	}
 	// universe templating
 	Universe struct {
 		reportCreator func(string, ...interface{}) report.Node
 		templates     map[string]*Template
 		stylesheets   map[string]string
+		maxDepth      int // max nesting depth of the placed and injected templates on rendering
 	}
 	Template struct {
-		name      string
-		fragments []interface{}
+		name             string
+		fragments        []interface{}
+		params           []param                // params schema entries
+		props            map[string]interface{} // params defaults
+		references       []reference            // templates, referenced by the rules
+		stylesheet       string                 // name of the template stylesheet
+		stylingTemplates []string               // names of the styling templates, used by the class rules
+	}
+	compilation struct { // state of the template compilation, it is not retained by the compiled template
+		branches int      // nesting level of the conditional branches, which are being compiled
+		path     []string // template name, branches labels and tags of the rule, which is being compiled
+	}
+	reference struct { // template name, referenced by the rule, references are verified when all the templates are compiled
+		kind    EdgeKind
+		rule    string // rule description for the report
+		name    string
+		guarded bool   // true, when the template is placed conditionally, so it could be placed recursively
+		at      string // human-readable location of the rule
 	}
 
 	// trees traversing
 	iterator struct {
-		cursor     int
-		path       []int
-		label      string
-		items      []interface{}
-		paramsType string      // only for rendering,
-		params     interface{} // []map[string]interface{} or map[string]interface{} // only for rendering,
+		cursor int
+		path   []int
+		label  string
+		items  []interface{}
 	}
 	// rules
 	doctype   string   // allows to place HTML5 doctype: <!DOCTYPE html>
@@ -69,15 +102,31 @@ type (
 		value string
 	}
 	attributeInjection struct { // allows to inject attribute value, works only as a child of tagAttributes rule
+		unsafe       bool // value could be safe (attribute escaping and URL filtering will be applied) or unsafe (value will be placed as is)
+		name         string
+		key          string
+		filterChains []FilterChain
+		filters      []filter // defined on template compilation by the filter chains
+		at           location
+	}
+	booleanAttribute struct { // allows to place boolean attribute (without value) when the param is true, works only as a child of tagAttributes rule
 		name string
 		key  string
+		at   location
+	}
+	optionalAttributeInjection struct { // allows to inject attribute, which is omitted when the param is absent or empty, works only as a child of tagAttributes rule
+		name         string
+		key          string
+		filterChains []FilterChain
+		filters      []filter // defined on template compilation by the filter chains
+		at           location
 	}
 	tag struct { // allows to place an HTML tag
 		name           string
 		attributesRule TagAttributes
 		contentRule    TagContent
 	}
-	TagAttributes  []interface{} // attribute or attributeInjection rules
+	TagAttributes  []interface{} // attribute, attributeInjection, booleanAttribute or optionalAttributeInjection rules
 	tagSelfClosing struct {      // nil, for "/>""
 		selfClosing interface{}
 	}
@@ -94,33 +143,114 @@ type (
 		text   string
 	}
 	textInjection struct { // allows to inject safe or unsafe text by the key on template rendering
-		unsafe bool // text could be safe (HTML escape will be applied) or unsafe (text will be placed as is)
-		key    string
+		unsafe        bool // text could be safe (HTML escape will be applied) or unsafe (text will be placed as is)
+		key           string
+		formatterName string           // optional name of the formatter, registered on Limbo
+		formatter     ContextFormatter // defined on template compilation by the formatter name
+		filterChains  []FilterChain
+		filters       []filter      // defined on template compilation by the filter chains
+		context       escapeContext // defined on template compilation by the parent tags
+		at            location
 	}
 	templatePlacement struct { // allows to use other templates within the current one
-		name string // template name
-		key  string // params key for namespaceing to avoid naming conflicts for injections
+		name             string        // template name
+		key              string        // params key for namespaceing to avoid naming conflicts for injections
+		props            StaticProps   // params values, used when they are not provided by params
+		children         TagContent    // content, placed by the template's Children() rule
+		compiledChildren []interface{} // defined on template compilation
+		at               location
+	}
+	childrenPlacement struct { // allows to place content, provided by the template placement
+		childrenPlacement interface{}
+		at                location
 	}
 	templateInjection struct { // allows to inject template (place other template content on template rendering)
-		key string
+		key     string
+		allowed []string // names of the templates, which could be injected, any template could be injected when empty
+		at      location
 	}
 	repeatable struct { // allows to repeat given rule rendering for N times, when N is a len() of a slice, provided through params on template rendering
-		key  string
+		key                string
+		rule               interface{}
+		otherwise          interface{} // rendered when the slice is empty or not provided
+		hasElse            bool
+		order              *OrderBy      // map entries order, when the map is repeated instead of the slice
+		fragments          []interface{} // compiled rule, defined on template compilation
+		otherwiseFragments []interface{} // compiled otherwise rule, defined on template compilation
+		label              string        // frame labels for the error locations, defined on template compilation
+		otherwiseLabel     string
+		at                 location
+	}
+	// ElseRule is the rule, rendered when there is nothing to repeat.
+	ElseRule struct {
 		rule interface{}
 	}
+	// OrderBy defines the order, in which RepeatMap() iterates the map entries.
+	OrderBy struct {
+		keysKey string                 // params key of the keys list, which defines the order
+		less    func(a, b string) bool // custom keys comparison
+	}
 	class struct {
 		name                              string // class base name
 		stylingTemplateName               string
 		stylingTemplateSelectorInjections map[string]string
+		at                                location
 	}
 	variant struct { // allows to place one or another of the predefined variants, for example: text or tag, depending on the key provided by params object on template rendering
 		defaultTemplateName string // use __default key to provide data to the default rule. default rule is mandatory, but you can avoid rendering of anything with nothing rule.
 		templates           map[string]string
+		keys                []string // sorted templates keys, defined on template compilation to check keys in the deterministic order
+		at                  location
+	}
+	switchRule struct { // allows to place one of the templates, depending on the string value of the discriminator param on template rendering
+		key   string
+		cases []SwitchCase
+		at    location
+	}
+	// SwitchCase is the template, placed by Switch() rule, when the discriminator value matches the case.
+	SwitchCase struct {
+		value        string
+		templateName string
+		isDefault    bool
+	}
+	switching struct { // compiled switch rule
+		key                 string
+		templates           map[string]string // discriminator value -> template name
+		defaultTemplateName string            // could be empty, when the switch has no default case
+		at                  location
+	}
+	condition struct { // allows to render one or another content depending on the param value on template rendering
+		key       string
+		then      interface{} // TagContent or TagAttributes, rendered when the param is true, non-empty string or non-empty slice
+		otherwise interface{} // TagContent or TagAttributes, rendered in other cases, could be nil
+		unless    bool        // Unless() rule, then and otherwise are swapped
+		at        location
+	}
+	conditional struct { // compiled condition rule
+		key            string
+		then           []interface{}
+		otherwise      []interface{}
+		unless         bool
+		thenLabel      string // frame labels for the error locations
+		otherwiseLabel string
+		at             location
+	}
+	slot struct { // allows layout to declare a named block, which content is provided by the extending templates
+		name           string
+		defaultContent TagContent // placed when the slot is not filled
+		at             location
+	}
+	slotEnd struct { // signalizes about the end of slot content, to detect recursive slots filling
+		name string
+	}
+	extension struct { // template content, which is the layout's content with filled slots
+		layoutName string
+		fills      map[string]TagContent
 	}
 	nothing struct { // allows to place nothing, makes sense only as a direct child of variant rule.
 		nothing interface{}
 	}
-	jump struct { // allows to jump back to the next parrent's sibling, we use theEnd rule for both: template preparation and rendering
+	jump struct { // allows to jump back to the next parrent's sibling on template preparation
 		iterator *iterator
 	}
 	theEnd struct { // signalizes about the end of rules tree traversing, we use theEnd rule for both: template preparation and rendering
@@ -130,6 +260,9 @@ type (
 
 const auto = "__auto__"
 
+// DefaultMaxDepth is the default max nesting depth of the placed and injected templates on rendering.
+const DefaultMaxDepth = 100
+
 // returns rule template name and selector generator for that rule template
 func ruleTemplateNameAndSelectorGenerator(template []interface{}) (string, func(map[string]string) (string, error)) {
 	_ruleName := []string{}
@@ -190,10 +323,37 @@ func Attr(n, v string) interface{} {
 		value: v,
 	}
 }
-func AttrInjection(name, key string) interface{} {
+func AttrInjection(name, key string, filters ...FilterChain) interface{} {
 	return attributeInjection{
-		name,
-		key,
+		unsafe:       false,
+		name:         name,
+		key:          key,
+		filterChains: filters,
+		at:           here(),
+	}
+}
+func UnsafeAttrInjection(name, key string, filters ...FilterChain) interface{} {
+	return attributeInjection{
+		unsafe:       true,
+		name:         name,
+		key:          key,
+		filterChains: filters,
+		at:           here(),
+	}
+}
+func BoolAttr(name, key string) interface{} {
+	return booleanAttribute{
+		name: name,
+		key:  key,
+		at:   here(),
+	}
+}
+func OptionalAttrInjection(name, key string, filters ...FilterChain) interface{} {
+	return optionalAttributeInjection{
+		name:         name,
+		key:          key,
+		filterChains: filters,
+		at:           here(),
 	}
 }
 
@@ -205,9 +365,10 @@ func Class(name string, stylingTemplateName string, styleTemplateSelectorInjecti
 	}
 	styleTemplateSelectorInjections[SELF_CLASS_PLACEMENT] = "." + name
 	c := class{
-		name,
-		stylingTemplateName,
-		styleTemplateSelectorInjections,
+		name:                              name,
+		stylingTemplateName:               stylingTemplateName,
+		stylingTemplateSelectorInjections: styleTemplateSelectorInjections,
+		at:                                here(),
 	}
 	return c
 }
@@ -223,39 +384,274 @@ func UnsafeText(t string) interface{} {
 		text:   t,
 	}
 }
-func TextInj(k string) interface{} {
+func TextInj(k string, filters ...FilterChain) interface{} {
 	return textInjection{
-		unsafe: false,
-		key:    k,
+		unsafe:       false,
+		key:          k,
+		filterChains: filters,
+		at:           here(),
+	}
+}
+
+// TextInjFormat() injects text, formatted by the formatter registered on Limbo with the given name.
+func TextInjFormat(k, formatterName string, filters ...FilterChain) interface{} {
+	return textInjection{
+		unsafe:        false,
+		key:           k,
+		formatterName: formatterName,
+		filterChains:  filters,
+		at:            here(),
 	}
 }
+
+// Deprecated: UnsafeTextInj() places any text as is, provide trusted HTML as SafeHTML value for TextInj() instead.
 func UnsafeTextInj(k string) interface{} {
 	return textInjection{
 		unsafe: true,
 		key:    k,
+		at:     here(),
 	}
 }
 func TemplatePlacement(n, k string) interface{} {
 	return templatePlacement{
 		name: n,
 		key:  k,
+		at:   here(),
+	}
+}
+
+// TemplatePlacementWith() places the template with the static props, which are used when params don't provide the values.
+func TemplatePlacementWith(n, k string, props StaticProps) interface{} {
+	return templatePlacement{
+		name:  n,
+		key:   k,
+		props: props,
+		at:    here(),
 	}
 }
-func TemplateInjection(k string) interface{} {
+
+// TemplatePlacementWithChildren() places the template and provides the content for its Children() rule.
+// Children content is rendered with the current params.
+func TemplatePlacementWithChildren(n, k string, children TagContent) interface{} {
+	return templatePlacement{
+		name:     n,
+		key:      k,
+		children: children,
+		at:       here(),
+	}
+}
+func Children() interface{} {
+	return childrenPlacement{childrenPlacement: true, at: here()}
+}
+
+// TemplateInjection() injects the template, which name and params are provided by params under the key k on rendering.
+// When allowed templates are specified, only they could be injected, the others are reported as errors.
+func TemplateInjection(k string, allowed ...string) interface{} {
 	return templateInjection{
-		key: k,
+		key:     k,
+		allowed: allowed,
+		at:      here(),
 	}
 }
 func Repeat(k string, r interface{}) interface{} {
 	return repeatable{
 		key:  k,
 		rule: r,
+		at:   here(),
 	}
 }
+
+// RepeatWith() repeats the rule like Repeat() does, but renders the else rule, when the slice is empty or not provided.
+// Within the item the loop metadata is available by pseudo-keys: $index, $number, $first, $last, $odd and $even,
+// the item itself is available by $item, so slices of strings or numbers could be repeated too.
+func RepeatWith(k string, r interface{}, e ElseRule) interface{} {
+	return repeatable{
+		key:       k,
+		rule:      r,
+		otherwise: e.rule,
+		hasElse:   true,
+		at:        here(),
+	}
+}
+
+// RepeatMap() repeats the rule for each entry of the map with string keys in the given order.
+// Within the entry the key and the value are available by $key and $value pseudo-keys,
+// when the value is a map or a struct, its params are available by their keys too.
+func RepeatMap(k string, r interface{}, o OrderBy) interface{} {
+	return repeatable{
+		key:   k,
+		rule:  r,
+		order: &o,
+		at:    here(),
+	}
+}
+
+// SortedKeys() orders map entries by keys in ascending order.
+func SortedKeys() OrderBy {
+	return OrderBy{}
+}
+
+// KeysOrder() orders map entries as the keys list, provided by params under the key k on rendering.
+// The keys list is any slice, its items are formatted into keys like the text injections are.
+// Entries, which keys are not listed, are placed after the listed ones in ascending order.
+func KeysOrder(k string) OrderBy {
+	return OrderBy{
+		keysKey: k,
+	}
+}
+
+// CustomOrder() orders map entries by keys with the given comparison.
+func CustomOrder(less func(a, b string) bool) OrderBy {
+	return OrderBy{
+		less: less,
+	}
+}
+
+// sorts map entries, param resolves the keys list for KeysOrder().
+func (o *OrderBy) sort(entries []interface{}, param func(key string) (interface{}, bool, error)) error {
+	switch {
+	case o.less != nil:
+		sort.SliceStable(entries, func(i, j int) bool {
+			return o.less(entries[i].(mapEntry).key, entries[j].(mapEntry).key)
+		})
+	case len(o.keysKey) > 0:
+		_keys, exists, err := param(o.keysKey)
+		if err != nil {
+			return fmt.Errorf("keys order \"%s\": %w", o.keysKey, err)
+		}
+		if !exists {
+			return &MissingParamError{Rule: "keys order", Key: o.keysKey}
+		}
+		keys, ok := listParams(_keys)
+		if !ok {
+			return fmt.Errorf("keys order \"%s\" should be a slice, got: %T", o.keysKey, _keys)
+		}
+		positions := make(map[string]int, len(keys))
+		for i, rawKey := range keys {
+			k, err := formatValue(rawKey)
+			if err != nil {
+				return fmt.Errorf("keys order \"%s\" key %d: %s", o.keysKey, i, err)
+			}
+			if _, exists := positions[k]; !exists {
+				positions[k] = i
+			}
+		}
+		sort.SliceStable(entries, func(i, j int) bool {
+			pi, listedI := positions[entries[i].(mapEntry).key]
+			pj, listedJ := positions[entries[j].(mapEntry).key]
+			switch {
+			case listedI && listedJ:
+				return pi < pj
+			case listedI != listedJ:
+				return listedI
+			}
+			return false // entries are sorted by keys already
+		})
+	}
+	return nil
+}
+func Else(r interface{}) ElseRule {
+	return ElseRule{
+		rule: r,
+	}
+}
+
+// Variant() places the template of the first provided variant key, keys are checked in ascending order.
 func Variant(dr string, variants map[string]string) interface{} {
 	return variant{
 		defaultTemplateName: dr,
 		templates:           variants,
+		at:                  here(),
+	}
+}
+
+// Switch() places the template of the case, which value equals to the string value of the discriminator param k.
+// The default template is placed, when the discriminator is not provided or doesn't match any case.
+// The placed template receives the same params as the current template level.
+func Switch(k string, cases ...SwitchCase) interface{} {
+	return switchRule{
+		key:   k,
+		cases: cases,
+		at:    here(),
+	}
+}
+func Case(v, n string) SwitchCase {
+	return SwitchCase{
+		value:        v,
+		templateName: n,
+	}
+}
+
+// DefaultCase() places the template, when the discriminator is not provided or no case matches it.
+// It is not named Default(), because gomega exports Default too, and the test files usually dot-import both packages.
+func DefaultCase(n string) SwitchCase {
+	return SwitchCase{
+		templateName: n,
+		isDefault:    true,
+	}
+}
+
+// checks whether the template could be injected, any template is allowed, when the allowlist is empty.
+func allowedTemplate(allowed []string, n string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if a == n {
+			return true
+		}
+	}
+	return false
+}
+
+// returns name of the template, chosen by the discriminator value, or an error, when there is no template to choose.
+func switchCase(templates map[string]string, defaultTemplateName string, v interface{}, exists bool) (string, error) {
+	if !exists {
+		if len(defaultTemplateName) == 0 {
+			return "", fmt.Errorf("discriminator is not provided")
+		}
+		return defaultTemplateName, nil
+	}
+	value, err := formatValue(v)
+	if err != nil {
+		return "", fmt.Errorf("discriminator should be a string, got: %T", v)
+	}
+	if n, ok := templates[value]; ok {
+		return n, nil
+	}
+	if len(defaultTemplateName) == 0 {
+		return "", fmt.Errorf("no case for \"%s\"", value)
+	}
+	return defaultTemplateName, nil
+}
+func If(k string, then, otherwise interface{}) interface{} {
+	return condition{
+		key:       k,
+		then:      then,
+		otherwise: otherwise,
+		at:        here(),
+	}
+}
+func Unless(k string, then, otherwise interface{}) interface{} {
+	return condition{
+		key:       k,
+		then:      otherwise,
+		otherwise: then,
+		unless:    true,
+		at:        here(),
+	}
+}
+func Slot(n string, defaultContent TagContent) interface{} {
+	return slot{
+		name:           n,
+		defaultContent: defaultContent,
+		at:             here(),
+	}
+}
+func Fill(slot string, content TagContent) SlotFill {
+	return SlotFill{
+		slot:    slot,
+		content: content,
 	}
 }
 func Nothing() interface{} {
@@ -281,8 +677,6 @@ var selfClosingTags = []string{
 }
 
 const DOCTYPE = "<!DOCTYPE html>"
-const paramsTypeMap = "map"
-const paramsTypeSlice = "slice"
 
 func selfClosingTag(n string) bool {
 	for _, t := range selfClosingTags {
@@ -300,26 +694,6 @@ func newIterator(path []int, label string, items []interface{}) *iterator {
 		items:  items,
 	}
 }
-func newIteratorWithParamsMap(path []int, label string, items []interface{}, params map[string]interface{}) *iterator {
-	return &iterator{
-		cursor:     -1,
-		path:       path,
-		label:      label,
-		items:      items,
-		params:     params,
-		paramsType: paramsTypeMap,
-	}
-}
-func newIteratorWithParamsSlice(path []int, label string, items []interface{}, params []map[string]interface{}) *iterator {
-	return &iterator{
-		cursor:     -1,
-		path:       path,
-		label:      label,
-		items:      items,
-		params:     params,
-		paramsType: paramsTypeSlice,
-	}
-}
 func (iter *iterator) next() interface{} {
 	iter.cursor = iter.cursor + 1
 	if iter.cursor < len(iter.items) {
@@ -327,25 +701,28 @@ func (iter *iterator) next() interface{} {
 	}
 	return nil
 }
-func (iter *iterator) getParams() map[string]interface{} {
-	switch iter.paramsType {
-	case paramsTypeMap:
-		return iter.params.(map[string]interface{})
-	case paramsTypeSlice:
-		return iter.params.([]map[string]interface{})[iter.cursor]
-	default:
-		panic("wrong params type") // can't occur
-	}
-}
 
 // New() creates new Limbo object for dirty templates spec.
 func New(rc func(string, ...interface{}) report.Node) *Limbo {
-	return &Limbo{
+	l := &Limbo{
 		reportCreator:    rc,
 		rn:               rc("limbo"),
 		stylingTemplates: make(map[string]StylingTemplate),
 		stylesheets:      make(map[string]Stylesheet),
+		formatters:       make(map[string]ContextFormatter),
+		filters:          make(map[string]ContextFilterFunc),
+		maxDepth:         DefaultMaxDepth,
+	}
+	for name, f := range builtinFilters {
+		l.Filter(name, f)
 	}
+	return l
+}
+
+// *Limbo.MaxDepth() limits the nesting depth of the placed and injected templates on rendering,
+// to stop the recursive rendering, for example, of the injected template, which injects itself.
+func (l *Limbo) MaxDepth(n int) {
+	l.maxDepth = n
 }
 func WithLayout(content ...interface{}) func(*LimboTemplate) bool {
 	return func(t *LimboTemplate) bool {
@@ -377,6 +754,56 @@ func WithAttributes(attrs ...interface{}) func(*LimboTemplate) bool {
 		return true
 	}
 }
+
+// Extends() makes the template content to be the layout's content, where slots are filled with the provided content.
+// Layout could extend other layout, in this case the slot is filled by the most derived template.
+// Stylesheet is inherited from the layout, unless it is specified for the template.
+func Extends(layoutName string, fills ...SlotFill) func(*LimboTemplate) bool {
+	return func(t *LimboTemplate) bool {
+		if t.content != nil {
+			t.rn.Error("templete content already specified")
+			return false
+		}
+		ext := extension{
+			layoutName: layoutName,
+			fills:      map[string]TagContent{},
+		}
+		for _, f := range fills {
+			if _, exists := ext.fills[f.slot]; exists {
+				t.rn.Error("slot \"%s\" already filled", f.slot)
+				return false
+			}
+			ext.fills[f.slot] = f.content
+		}
+		t.content = ext
+		return true
+	}
+}
+func Prop(k string, v interface{}) TemplateProp {
+	return TemplateProp{
+		key:   k,
+		value: v,
+	}
+}
+
+// WithProps() specifies defaults for the template params, they are used on rendering when params don't provide the values.
+func WithProps(props ...TemplateProp) func(*LimboTemplate) bool {
+	return func(t *LimboTemplate) bool {
+		if t.props != nil {
+			t.rn.Error("template props already specified")
+			return false
+		}
+		t.props = map[string]interface{}{}
+		for _, p := range props {
+			if _, exists := t.props[p.key]; exists {
+				t.rn.Error("template prop \"%s\" already specified", p.key)
+				return false
+			}
+			t.props[p.key] = p.value
+		}
+		return true
+	}
+}
 func Itself() SelectorInjection {
 	return SelectorInjection{Name: SELF_CLASS_PLACEMENT}
 }
@@ -467,6 +894,10 @@ func (l *Limbo) Template(n string, opts ...func(*LimboTemplate) bool) {
 		return
 	}
 	sname := t.stylesheetName
+	if _, extends := t.content.(extension); extends && len(sname) == 0 {
+		l.templates = append(l.templates, t) // stylesheet will be inherited from the layout
+		return
+	}
 	if !(len(sname) > 0) {
 		t.rn.Error("template stylesheet should be specified")
 		return
@@ -487,8 +918,10 @@ func (l *Limbo) Universe() (u *Universe, r report.Node) {
 		templates:     make(map[string]*Template),
 		reportCreator: l.reportCreator,
 		stylesheets:   map[string]string{},
+		maxDepth:      l.maxDepth,
 	}
 	// go through limbo template to prepare final (universe) templates
+	names := make([]string, 0, len(l.templates)) // in the order of specification, for the deterministic report
 	for _, lt := range l.templates {
 		if _, exists := u.templates[lt.name]; exists {
 			r.Error("template \"%s\" already specified", lt.name)
@@ -497,7 +930,15 @@ func (l *Limbo) Universe() (u *Universe, r report.Node) {
 		t := &Template{
 			name: lt.name,
 		}
-		fragments := []interface{}{}
+		if _, extends := lt.content.(extension); extends {
+			var ok bool
+			lt, ok = l.resolveExtension(r, lt)
+			if !ok {
+				return nil, r
+			}
+		}
+		t.props = lt.props
+		t.stylesheet = lt.stylesheetName
 		var topContent []interface{}
 		switch rawTopContent := lt.content.(type) {
 		case documentContent:
@@ -510,114 +951,25 @@ func (l *Limbo) Universe() (u *Universe, r report.Node) {
 			// todo: add check for only tag attribures (no doctype or tag content)
 			topContent = []interface{}(rawTopContent)
 		default:
-			r.Error("wrong type of top content rule, expected: documentContent, TagContent, TagAttributes %#v", fragments)
+			r.Error("wrong type of top content rule, expected: documentContent, TagContent, TagAttributes %#v", lt.content)
 			return nil, r
 		}
-		iter := newIterator([]int{}, "top", topContent)
-		traverse := true
-		for traverse {
-			rule := iter.next()
-			switch fragment := rule.(type) {
-			case theEnd:
-				traverse = false // stops the loop because rules tree traversing is finished
-			case jump:
-				iter = fragment.iterator
-				continue
-			case doctype:
-				fragments = appendFragments(fragments, DOCTYPE)
-			case tag:
-				fragments = appendFragments(fragments, fmt.Sprintf("<%s", fragment.name))
-				// for tag we flatten attributes and content rule into a single list of rules
-				// because of that tagAttributes and tagContent rules are ignored, but not their content.
-				// this allows to make less jumps and gets in theory some performance improvement.
-				rules := []interface{}{}
-				if len(fragment.attributesRule) > 0 {
-					rules = append(rules, fragment.attributesRule...)
-				}
-				if selfClosingTag(fragment.name) {
-					rules = append(rules, tagSelfClosing{selfClosing: true})
-				} else {
-					rules = append(rules, tagEnd{tagEnd: true})
-					if len(fragment.contentRule) > 0 {
-						rules = append(rules, fragment.contentRule...)
-					}
-					rules = append(rules, tagClosing{fragment.name})
-				}
-				rules = append(rules, jump{iterator: iter}) // allows to jump to the parrent's sibling at the end
-				iter = newIterator(append(iter.path, iter.cursor), fmt.Sprintf("<%s>", fragment.name), rules)
-			case tagEnd:
-				fragments = appendFragments(fragments, ">")
-			case tagClosing:
-				fragments = appendFragments(fragments, fmt.Sprintf("</%s>", fragment.tag))
-			case tagSelfClosing:
-				fragments = appendFragments(fragments, "/>")
-			case TagAttributes: // not achievable if tagAttributes is within tagRule because of flattening
-				iter = newIterator(append(iter.path, iter.cursor), "attrs", []interface{}(fragment))
-			case TagContent: // not achievable if tagContent is within tagRule because of flattening
-				iter = newIterator(append(iter.path, iter.cursor), "content", []interface{}(fragment))
-			case attribute:
-				fragments = appendFragments(
-					fragments,
-					fmt.Sprintf(" %s=\"%s\"", fragment.name, fragment.value))
-			case class:
-				fragments = appendFragments(fragments, fmt.Sprintf(" class=\"%s\"", fragment.name))
-				s := l.stylesheets[lt.stylesheetName]
-				stylingTemplateRule, exists := s.stylingTemplateRules[fragment.stylingTemplateName]
-				if !exists {
-					r.Error("styling template \"%s\" does not exist", fragment.stylingTemplateName)
-					return
-				}
-				for ruleTemplateName, selectorGenerator := range stylingTemplateRule.stylingTemplate.selectorGenerators {
-					selector, err := selectorGenerator(fragment.stylingTemplateSelectorInjections)
-					if err != nil {
-						r.Error(err.Error())
-					}
-					stylingTemplateRule.selectors[ruleTemplateName] = append(stylingTemplateRule.selectors[ruleTemplateName], selector)
-				}
-			case attributeInjection:
-				fragments = appendFragments(
-					fragments,
-					fmt.Sprintf(" %s=\"", fragment.name),
-					fragment, // attribute value injection
-					"\"",
-				)
-			case text:
-				var text = fragment.text
-				if !fragment.unsafe {
-					text = safeTextReplacer.Replace(text)
-				}
-				fragments = appendFragments(fragments, text)
-			case textInjection:
-				fragments = appendFragments(fragments, fragment)
-			case templatePlacement:
-				exists := false
-				for _, lt := range l.templates {
-					if lt.name == fragment.name {
-						exists = true
-						break
-					}
-				}
-				if !exists {
-					r.Error("template \"%s\" not defined", fragment.name)
-					return nil, r
-				}
-				fragments = appendFragments(fragments, fragment)
-			case templateInjection:
-				fragments = appendFragments(fragments, fragment)
-			case repeatable:
-				fragments = appendFragments(fragments, fragment)
-			case variant:
-				fragments = appendFragments(fragments, fragment)
-			case documentContent:
-				iter = newIterator(append(iter.path, iter.cursor), "document content", []interface{}(fragment))
-			default:
-				r.Error("wrong rule %#v, iterator: %#v", rule, iter)
-				return
+		c := &compilation{path: []string{t.name}}
+		fragments, ok := l.compile(r, lt, t, c, topContent, textContext)
+		if !ok {
+			return nil, r
+		}
+		for slotName := range lt.fills {
+			if !lt.filledSlots[slotName] {
+				r.Warn("slot \"%s\" filled by template \"%s\" is not placed by its layouts", slotName, lt.name)
 			}
 		}
-		fragments = appendFragments(fragments, theEnd{})
 		t.fragments = fragments
 		u.templates[t.name] = t
+		names = append(names, t.name)
+	}
+	if !u.verifyReferences(r, names) || !u.detectCycles(r, names) {
+		return nil, r
 	}
 	for n, stylesheet := range l.stylesheets {
 		sr := r.Structure("stylesheet \"%s\" generation", n)
@@ -661,187 +1013,477 @@ func (l *Limbo) Universe() (u *Universe, r report.Node) {
 	return
 }
 
-var safeTextReplacer = strings.NewReplacer("<", "&lt;", ">", "&gt;", "\"", "&quot", "'", "&quot")
-
-func appendFragments(fragments []interface{}, newRawFragments ...interface{}) []interface{} {
-	if len(fragments) == 0 {
-		fragments = append(fragments, newRawFragments[0])
-		newRawFragments = newRawFragments[1:]
+// reports cycles of the unconditional template placements, because their rendering never ends.
+func (u *Universe) detectCycles(r report.Node, names []string) bool {
+	const (
+		visiting = iota + 1
+		visited
+	)
+	valid := true
+	states := map[string]int{}
+	path := []string{}
+	var visit func(n string)
+	visit = func(n string) {
+		states[n] = visiting
+		path = append(path, n)
+		for _, ref := range u.templates[n].references {
+			if ref.guarded {
+				continue
+			}
+			switch states[ref.name] {
+			case visiting:
+				i := len(path) - 1
+				for path[i] != ref.name {
+					i--
+				}
+				cycle := append(append([]string{}, path[i:]...), ref.name)
+				r.Error("templates placement cycle: %s", strings.Join(cycle, " -> "))
+				valid = false
+			case 0:
+				visit(ref.name)
+			}
+		}
+		path = path[:len(path)-1]
+		states[n] = visited
 	}
-	for _, newRawFragment := range newRawFragments {
-		lastIdx := len(fragments) - 1
-		prevFragment := fragments[lastIdx]
-		switch newFragment := newRawFragment.(type) {
-		case string:
-			switch prevValue := prevFragment.(type) {
-			case string:
-				fragments[lastIdx] = prevValue + newFragment
-			default:
-				fragments = append(fragments, newFragment)
+	for _, n := range names {
+		if states[n] == 0 {
+			visit(n)
+		}
+	}
+	return valid
+}
+
+// checks that all the templates, referenced by the rules, exist. All the missing templates are reported at once.
+func (u *Universe) verifyReferences(r report.Node, names []string) bool {
+	valid := true
+	for _, n := range names {
+		t, exists := u.templates[n]
+		if !exists {
+			continue
+		}
+		var tr report.Node
+		for _, ref := range t.references {
+			if _, exists := u.templates[ref.name]; exists {
+				continue
 			}
-		default:
-			fragments = append(fragments, newFragment)
+			if tr == nil {
+				tr = r.Structure("template \"%s\" references", n)
+			}
+			tr.Error("%s: template \"%s\" doesn't exist at %s", ref.rule, ref.name, ref.at)
+			valid = false
 		}
 	}
-	return fragments
+	return valid
 }
 
-func (u *Universe) Render(n string, params map[string]interface{}) (string, report.Node) {
-	r := u.reportCreator("rendering template \"%s\"", n)
-	t, ok := u.templates[n]
-	if !ok {
-		r.Error("template \"%s\" not found", n)
-		return "", r
+// returns the template with the content of the root layout and slots fills, collected through the extension chain.
+func (l *Limbo) resolveExtension(r report.Node, lt LimboTemplate) (LimboTemplate, bool) {
+	resolved := lt
+	resolved.fills = map[string]TagContent{}
+	resolved.filledSlots = map[string]bool{}
+	chain := []string{lt.name}
+	for {
+		ext, extends := resolved.content.(extension)
+		if !extends {
+			return resolved, true
+		}
+		for slotName, content := range ext.fills {
+			if _, filled := resolved.fills[slotName]; !filled { // the most derived template fills the slot
+				resolved.fills[slotName] = content
+			}
+		}
+		chain = append(chain, ext.layoutName)
+		var layout *LimboTemplate
+		for i := range l.templates {
+			if l.templates[i].name == ext.layoutName {
+				layout = &l.templates[i]
+				break
+			}
+		}
+		if layout == nil {
+			r.Error("layout \"%s\" for template \"%s\" not defined", ext.layoutName, lt.name)
+			return lt, false
+		}
+		for _, n := range chain[:len(chain)-1] {
+			if n == layout.name {
+				r.Error("layouts extension cycle: %s", strings.Join(chain, " -> "))
+				return lt, false
+			}
+		}
+		if len(resolved.stylesheetName) == 0 {
+			resolved.stylesheetName = layout.stylesheetName
+		}
+		if len(layout.props) > 0 {
+			props := map[string]interface{}{}
+			for k, v := range layout.props {
+				props[k] = v
+			}
+			for k, v := range resolved.props { // the most derived template defines the default
+				props[k] = v
+			}
+			resolved.props = props
+		}
+		resolved.content = layout.content
 	}
-	var sb strings.Builder
-	iter := newIteratorWithParamsMap([]int{}, "top", t.fragments, params)
+}
+
+// compiles rules tree into the flat list of fragments, rules should end with theEnd rule.
+// ctx is the escaping context of the rules, it is changed by <script> and <style> tags within the rules.
+func (l *Limbo) compile(r report.Node, lt LimboTemplate, t *Template, c *compilation, rules []interface{}, ctx escapeContext) (fragments []interface{}, ok bool) {
+	contexts := []escapeContext{ctx} // escaping contexts stack, by the opened tags
+	activeSlots := map[string]bool{} // slots, which content is being compiled
+	base := len(c.path)              // tags of the compiled fragments are pushed after the branch path
+	// returns location of the rule within the compiled fragments.
+	locate := func(at location, attr string) location {
+		return at.within(c.path[base:], attr)
+	}
+	// returns human-readable location of the rule within the template for the compilation report.
+	where := func(at location) string {
+		return at.describe(c.path[:base]...)
+	}
+	iter := newIterator([]int{}, "top", rules)
 	traverse := true
-traverseLoop:
 	for traverse {
-		rawFragment := iter.next()
-		switch f := rawFragment.(type) {
+		rule := iter.next()
+		switch fragment := rule.(type) {
 		case theEnd:
-			traverse = false
+			traverse = false // stops the loop because rules tree traversing is finished
 		case jump:
-			iter = f.iterator
-		case string:
-			sb.WriteString(f)
-		case templatePlacement:
-			tPl, exists := u.templates[f.name]
-			if !exists {
-				r.Error("template \"%s\" not found", f.name)
-				return "", r
-			}
-			if f.key == auto { // when rendering within repeatable rule
-				iter = newIteratorWithParamsMap(
-					append(iter.path, iter.cursor),
-					"template placement",
-					append(tPl.fragments[:len(tPl.fragments)-1], jump{iterator: iter}),
-					iter.getParams())
+			iter = fragment.iterator
+			continue
+		case doctype:
+			fragments = appendFragments(fragments, DOCTYPE)
+		case tag:
+			c.path = append(c.path, fragment.name)
+			fragments = appendFragments(fragments, fmt.Sprintf("<%s", fragment.name))
+			// for tag we flatten attributes and content rule into a single list of rules
+			// because of that tagAttributes and tagContent rules are ignored, but not their content.
+			// this allows to make less jumps and gets in theory some performance improvement.
+			rules := []interface{}{}
+			if len(fragment.attributesRule) > 0 {
+				rules = append(rules, fragment.attributesRule...)
+			}
+			if selfClosingTag(fragment.name) {
+				rules = append(rules, tagSelfClosing{selfClosing: true})
 			} else {
-				iter = newIteratorWithParamsMap(
-					append(iter.path, iter.cursor),
-					"template placement",
-					append(tPl.fragments[:len(tPl.fragments)-1], jump{iterator: iter}),
-					iter.getParams()[f.key].(map[string]interface{}))
+				rules = append(rules, tagEnd{tagEnd: true})
+				if len(fragment.contentRule) > 0 {
+					rules = append(rules, fragment.contentRule...)
+				}
+				rules = append(rules, tagClosing{fragment.name})
 			}
-		case templateInjection:
-			_data, exists := params[f.key]
-			if !exists {
-				r.Error("template injection \"%s\" not provided", f.key)
-				return "", r
+			rules = append(rules, jump{iterator: iter}) // allows to jump to the parrent's sibling at the end
+			if !selfClosingTag(fragment.name) {
+				tagContext, exists := rawTextContexts[fragment.name]
+				if !exists {
+					tagContext = textContext
+				}
+				contexts = append(contexts, tagContext)
 			}
-			data, ok := _data.(map[string]interface{})
-			if !ok {
-				r.Error("wrong format of template injection \"%s\" data, expected map[string]interface{}, got: %#v", f.key, _data)
-				return "", r
+			iter = newIterator(append(iter.path, iter.cursor), fmt.Sprintf("<%s>", fragment.name), rules)
+		case tagEnd:
+			fragments = appendFragments(fragments, ">")
+		case tagClosing:
+			fragments = appendFragments(fragments, fmt.Sprintf("</%s>", fragment.tag))
+			contexts = contexts[:len(contexts)-1]
+			c.path = c.path[:len(c.path)-1]
+		case tagSelfClosing:
+			fragments = appendFragments(fragments, "/>")
+			c.path = c.path[:len(c.path)-1]
+		case TagAttributes: // not achievable if tagAttributes is within tagRule because of flattening
+			iter = newIterator(append(iter.path, iter.cursor), "attrs", []interface{}(fragment))
+		case TagContent: // not achievable if tagContent is within tagRule because of flattening
+			iter = newIterator(append(iter.path, iter.cursor), "content", []interface{}(fragment))
+		case attribute:
+			fragments = appendFragments(
+				fragments,
+				fmt.Sprintf(" %s=\"%s\"", fragment.name, escape(attributeContext, fragment.value)))
+		case class:
+			fragments = appendFragments(fragments, fmt.Sprintf(" class=\"%s\"", escape(attributeContext, fragment.name)))
+			s := l.stylesheets[lt.stylesheetName]
+			stylingTemplateRule, exists := s.stylingTemplateRules[fragment.stylingTemplateName]
+			if !exists {
+				r.Error("styling template \"%s\" does not exist at %s", fragment.stylingTemplateName, where(locate(fragment.at, "class")))
+				return nil, false
 			}
-			_tn, ok := data["name"]
-			if !ok {
-				r.Error("template name for injection \"%s\" not provided", f.key)
-				return "", r
+			t.stylingTemplates = append(t.stylingTemplates, fragment.stylingTemplateName)
+			for ruleTemplateName, selectorGenerator := range stylingTemplateRule.stylingTemplate.selectorGenerators {
+				selector, err := selectorGenerator(fragment.stylingTemplateSelectorInjections)
+				if err != nil {
+					r.Error("%s at %s", err.Error(), where(locate(fragment.at, "class")))
+				}
+				stylingTemplateRule.selectors[ruleTemplateName] = append(stylingTemplateRule.selectors[ruleTemplateName], selector)
 			}
-			tn, ok := _tn.(string)
+		case attributeInjection:
+			fragment.at = locate(fragment.at, fragment.name)
+			fragment.filters, ok = l.bindFilters(r, fragment.key, where(fragment.at), fragment.filterChains)
 			if !ok {
-				r.Error("template name for injection \"%s\"should be string", f.key)
-				return "", r
+				return nil, false
 			}
-			_injParams, ok := data["params"]
+			fragments = appendFragments(
+				fragments,
+				fmt.Sprintf(" %s=\"", fragment.name),
+				fragment, // attribute value injection
+				"\"",
+			)
+			t.params = append(t.params, injectionParam(fragment.key, AttrParam, fragment.filterChains))
+		case booleanAttribute:
+			fragment.at = locate(fragment.at, fragment.name)
+			fragments = appendFragments(fragments, fragment)
+			t.params = append(t.params, param{key: fragment.key, kind: BoolParam, optional: true})
+		case optionalAttributeInjection:
+			fragment.at = locate(fragment.at, fragment.name)
+			fragment.filters, ok = l.bindFilters(r, fragment.key, where(fragment.at), fragment.filterChains)
 			if !ok {
-				r.Error("template params for injection \"%s\" not provided", f.key)
-				return "", r
+				return nil, false
 			}
-			injParams, ok := _injParams.(map[string]interface{})
-			if !ok {
-				r.Error("template params for injection \"%s\" should be map[string]interface{}", f.key)
+			fragments = appendFragments(fragments, fragment)
+			p := injectionParam(fragment.key, AttrParam, fragment.filterChains)
+			p.optional = true
+			t.params = append(t.params, p)
+		case text:
+			var text = fragment.text
+			if !fragment.unsafe {
+				text = escapeStatic(contexts[len(contexts)-1], text)
 			}
-			injT, ok := u.templates[tn]
-			if !ok {
-				r.Error("template \"%s\" for injection doesn't exist", tn)
-				return "", r
-			}
-			iter = newIteratorWithParamsMap(
-				append(iter.path, iter.cursor),
-				"template injection",
-				append(injT.fragments[:len(injT.fragments)-1], jump{iterator: iter}),
-				injParams)
-		case attributeInjection:
-			_v, exists := iter.getParams()[f.key]
-			if !exists {
-				r.Error("attribute value injection \"%s\" not provided %#v", f.key)
-				return "", r
+			fragments = appendFragments(fragments, text)
+		case textInjection:
+			fragment.at = locate(fragment.at, "")
+			fragment.context = contexts[len(contexts)-1]
+			if len(fragment.formatterName) > 0 {
+				formatter, exists := l.formatters[fragment.formatterName]
+				if !exists {
+					r.Error("formatter \"%s\" for text injection \"%s\" not registered at %s", fragment.formatterName, fragment.key, where(fragment.at))
+					return nil, false
+				}
+				fragment.formatter = formatter
 			}
-			v, ok := _v.(string)
+			fragment.filters, ok = l.bindFilters(r, fragment.key, where(fragment.at), fragment.filterChains)
 			if !ok {
-				r.Error("text injection \"%s\"should be a string", f.key)
-				return "", r
+				return nil, false
 			}
-			sb.WriteString(v)
-		case textInjection:
-			_v, exists := iter.getParams()[f.key]
-			if !exists {
-				r.Error("text injection \"%s\" not provided (params: %#v)", f.key, iter.getParams())
-				return "", r
+			fragments = appendFragments(fragments, fragment)
+			p := injectionParam(fragment.key, TextParam, fragment.filterChains)
+			p.formatter = fragment.formatterName
+			t.params = append(t.params, p)
+		case templatePlacement:
+			fragment.at = locate(fragment.at, "")
+			if fragment.children != nil {
+				fragment.compiledChildren, ok = l.compileNested(r, lt, t, c, "Children()", fragment.children, contexts[len(contexts)-1])
+				if !ok {
+					return nil, false
+				}
 			}
-			v, ok := _v.(string)
-			if !ok {
-				r.Error("text injection \"%s\"should be a string", f.key)
-				return "", r
+			t.references = append(t.references, reference{kind: PlacementEdge, rule: fmt.Sprintf("placement \"%s\"", fragment.key), name: fragment.name, guarded: c.branches > 0, at: where(fragment.at)})
+			fragments = appendFragments(fragments, fragment)
+			if fragment.key == auto {
+				t.params = append(t.params, param{kind: inlineParam, template: fragment.name, props: fragment.props})
+			} else {
+				t.params = append(t.params, param{key: fragment.key, kind: NestedParam, template: fragment.name, props: fragment.props})
 			}
-			if !f.unsafe {
-				v = safeTextReplacer.Replace(v)
+		case templateInjection:
+			fragment.at = locate(fragment.at, "")
+			for _, n := range fragment.allowed {
+				t.references = append(t.references, reference{kind: InjectionEdge, rule: fmt.Sprintf("template injection \"%s\"", fragment.key), name: n, guarded: true, at: where(fragment.at)})
 			}
-			sb.WriteString(v)
+			fragments = appendFragments(fragments, fragment)
+			t.params = append(t.params, param{key: fragment.key, kind: InjectionParam, allowed: fragment.allowed})
+		case childrenPlacement:
+			fragment.at = locate(fragment.at, "")
+			fragments = appendFragments(fragments, fragment)
 		case repeatable:
-			rawRepParams, ok := iter.getParams()[f.key]
+			// item rule and else rule are compiled separately, like condition branches
+			fragment.at = locate(fragment.at, "")
+			params := t.params
+			t.params = nil
+			fragment.label = fmt.Sprintf("Repeat(%s)", fragment.key)
+			fragment.otherwiseLabel = fmt.Sprintf("Repeat(%s) else", fragment.key)
+			fragment.fragments, ok = l.compileBranch(r, lt, t, c, fragment.label, fragment.rule, contexts[len(contexts)-1])
 			if !ok {
-				r.Error("repeatable params \"%s\" are not provided", f.key)
-				return "", r
+				return nil, false
 			}
-			repParams, ok := rawRepParams.([]map[string]interface{})
-			if !ok {
-				r.Error("repeatable params should be of type []map[string]interface{}")
-				return "", nil
+			itemParams := t.params
+			t.params = nil
+			if fragment.hasElse {
+				fragment.otherwiseFragments, ok = l.compileBranch(r, lt, t, c, fragment.otherwiseLabel, fragment.otherwise, contexts[len(contexts)-1])
+				if !ok {
+					return nil, false
+				}
 			}
-			rules := []interface{}{}
-			for range repParams {
-				rules = append(rules, f.rule)
-			}
-			rules = append(rules, jump{iterator: iter})
-			iter = newIteratorWithParamsSlice(
-				append(iter.path, iter.cursor),
-				"repeatable",
-				rules,
-				repParams)
+			if fragment.order != nil {
+				t.params = append(params, param{key: fragment.key, kind: MapParam, params: itemParams})
+				if len(fragment.order.keysKey) > 0 {
+					keyParams := []param{{key: "$item", kind: TextParam}} // keys are formatted like the text injections
+					t.params = append(t.params, param{key: fragment.order.keysKey, kind: ListParam, params: keyParams})
+				}
+			} else {
+				t.params = append(params, param{key: fragment.key, kind: ListParam, params: itemParams, alternative: t.params, optional: fragment.hasElse})
+			}
+			fragments = appendFragments(fragments, fragment)
 		case variant:
-			for k, n := range f.templates {
-				if _, ok := iter.getParams()[k]; ok {
-					iter = newIteratorWithParamsMap(
-						append(iter.path, 0),
-						"variant",
-						[]interface{}{
-							templatePlacement{name: n, key: k},
-							jump{iterator: iter},
-						},
-						iter.getParams())
-					continue traverseLoop
+			fragment.at = locate(fragment.at, "")
+			fragment.keys = make([]string, 0, len(fragment.templates))
+			for k := range fragment.templates {
+				fragment.keys = append(fragment.keys, k)
+			}
+			sort.Strings(fragment.keys)
+			t.references = append(t.references, reference{kind: VariantEdge, rule: "variant default", name: fragment.defaultTemplateName, guarded: true, at: where(fragment.at)})
+			for _, k := range fragment.keys {
+				t.references = append(t.references, reference{kind: VariantEdge, rule: fmt.Sprintf("variant \"%s\"", k), name: fragment.templates[k], guarded: true, at: where(fragment.at)})
+			}
+			fragments = appendFragments(fragments, fragment)
+			for _, k := range fragment.keys {
+				t.params = append(t.params, param{key: k, kind: VariantParam, template: fragment.templates[k], optional: true})
+			}
+		case switchRule:
+			compiled := switching{
+				key:       fragment.key,
+				templates: map[string]string{},
+				at:        locate(fragment.at, ""),
+			}
+			valid := true
+			for _, c := range fragment.cases {
+				t.references = append(t.references, reference{kind: SwitchEdge, rule: fmt.Sprintf("switch \"%s\"", fragment.key), name: c.templateName, guarded: true, at: where(compiled.at)})
+				switch {
+				case c.isDefault && len(compiled.defaultTemplateName) > 0:
+					r.Error("switch \"%s\": default case is already specified at %s", fragment.key, where(compiled.at))
+					valid = false
+				case c.isDefault:
+					compiled.defaultTemplateName = c.templateName
+				case len(compiled.templates[c.value]) > 0:
+					r.Error("switch \"%s\": case \"%s\" is already specified at %s", fragment.key, c.value, where(compiled.at))
+					valid = false
+				default:
+					compiled.templates[c.value] = c.templateName
 				}
 			}
-			iter = newIteratorWithParamsMap(
-				append(iter.path, 0),
-				"variant",
-				[]interface{}{
-					templatePlacement{name: f.defaultTemplateName, key: Auto()},
-					jump{iterator: iter},
-				},
-				map[string]interface{}{})
+			if !valid {
+				return nil, false
+			}
+			fragments = appendFragments(fragments, compiled)
+			t.params = append(t.params, param{
+				key:      fragment.key,
+				kind:     SwitchParam,
+				template: compiled.defaultTemplateName,
+				cases:    compiled.templates,
+				optional: len(compiled.defaultTemplateName) > 0,
+			})
+		case condition:
+			// branches are compiled separately, because only one of them is rendered
+			params := t.params
+			t.params = nil
+			thenLabel, otherwiseLabel := fmt.Sprintf("If(%s)", fragment.key), fmt.Sprintf("If(%s) else", fragment.key)
+			if fragment.unless {
+				thenLabel, otherwiseLabel = fmt.Sprintf("Unless(%s) else", fragment.key), fmt.Sprintf("Unless(%s)", fragment.key)
+			}
+			then, ok := l.compileBranch(r, lt, t, c, thenLabel, fragment.then, contexts[len(contexts)-1])
+			if !ok {
+				return nil, false
+			}
+			thenParams := t.params
+			t.params = nil
+			otherwise, ok := l.compileBranch(r, lt, t, c, otherwiseLabel, fragment.otherwise, contexts[len(contexts)-1])
+			if !ok {
+				return nil, false
+			}
+			t.params = append(params, param{key: fragment.key, kind: ConditionParam, params: thenParams, alternative: t.params})
+			fragments = appendFragments(fragments, conditional{
+				key:            fragment.key,
+				then:           then,
+				otherwise:      otherwise,
+				unless:         fragment.unless,
+				thenLabel:      thenLabel,
+				otherwiseLabel: otherwiseLabel,
+				at:             locate(fragment.at, ""),
+			})
+		case slot:
+			if activeSlots[fragment.name] {
+				r.Error("slot \"%s\" is filled recursively at %s", fragment.name, where(locate(fragment.at, "")))
+				return nil, false
+			}
+			content, filled := lt.fills[fragment.name]
+			if filled {
+				lt.filledSlots[fragment.name] = true
+			} else {
+				content = fragment.defaultContent
+			}
+			activeSlots[fragment.name] = true
+			rules := append([]interface{}{}, content...)
+			rules = append(rules, slotEnd{name: fragment.name}, jump{iterator: iter})
+			iter = newIterator(append(iter.path, iter.cursor), fmt.Sprintf("slot \"%s\"", fragment.name), rules)
+		case slotEnd:
+			delete(activeSlots, fragment.name)
+		case documentContent:
+			iter = newIterator(append(iter.path, iter.cursor), "document content", []interface{}(fragment))
 		default:
-			r.Error("wrong type of fragment %#v", f)
-			return "", r
+			r.Error("wrong rule %#v, iterator: %#v", rule, iter)
+			return nil, false
 		}
 	}
-	return sb.String(), r
+	fragments = appendFragments(fragments, theEnd{})
+	return fragments, true
+}
+
+// compiles conditionally rendered rules: condition branches and repeated rules.
+// Templates, placed within the branch, are not rendered unconditionally, so they can't form placement cycles.
+// Label is the branch description for the rules locations.
+func (l *Limbo) compileBranch(r report.Node, lt LimboTemplate, t *Template, c *compilation, label string, branch interface{}, ctx escapeContext) ([]interface{}, bool) {
+	c.branches++
+	defer func() {
+		c.branches--
+	}()
+	return l.compileNested(r, lt, t, c, label, branch, ctx)
+}
+
+// compiles nested rules, which are rendered in the separate frame: branches and children content.
+// Children content is rendered, whenever the placed template renders its Children() rule, so it is not a conditional branch.
+func (l *Limbo) compileNested(r report.Node, lt LimboTemplate, t *Template, c *compilation, label string, branch interface{}, ctx escapeContext) ([]interface{}, bool) {
+	c.path = append(c.path, label)
+	defer func() {
+		c.path = c.path[:len(c.path)-1]
+	}()
+	return l.compile(r, lt, t, c, branchRules(branch), ctx)
+}
+
+// returns branch rules for compilation.
+func branchRules(branch interface{}) []interface{} {
+	rules := []interface{}{}
+	switch b := branch.(type) {
+	case nil:
+	case TagContent:
+		rules = append(rules, b...)
+	case TagAttributes:
+		rules = append(rules, b...)
+	default:
+		rules = append(rules, b)
+	}
+	return append(rules, theEnd{theEnd: true})
 }
+
+func appendFragments(fragments []interface{}, newRawFragments ...interface{}) []interface{} {
+	if len(fragments) == 0 {
+		fragments = append(fragments, newRawFragments[0])
+		newRawFragments = newRawFragments[1:]
+	}
+	for _, newRawFragment := range newRawFragments {
+		lastIdx := len(fragments) - 1
+		prevFragment := fragments[lastIdx]
+		switch newFragment := newRawFragment.(type) {
+		case string:
+			switch prevValue := prevFragment.(type) {
+			case string:
+				fragments[lastIdx] = prevValue + newFragment
+			default:
+				fragments = append(fragments, newFragment)
+			}
+		default:
+			fragments = append(fragments, newFragment)
+		}
+	}
+	return fragments
+}
+
 func (u *Universe) Stylesheets() map[string]string {
 	return u.stylesheets
 }
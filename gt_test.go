@@ -1,6 +1,11 @@
 package gt_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	. "github.com/Contra-Culture/gt"
@@ -201,4 +206,967 @@ var _ = Describe("gt", func() {
 		Expect(report.ToString(r)).To(Equal("#[2022-05-02T10:11:12.0000012Z] rendering template \"/layout/test\"\n"))
 		Expect(rendered).To(Equal("<!DOCTYPE html><html><head><title>::Test Template::</title><meta charset=\"utf-8\"/></head><body><header class=\"top-header\"><h1 class=\"top-header-title\">Test Header!</h1></header><div class=\"article-card\"><h1 class=\"article-card-title\">Article 1</h1><span class=\"article-card-preview\">Preview for article 1.</span><a class=\"article-card-link\" href=\"http://google.com\">google</a><div class=\"comment-card\"><span class=\"comment-card-author\">Sam</span><p class=\"comment-card-text\">good article</p></div><div class=\"comment-card\"><span class=\"comment-card-author\">John</span><p class=\"comment-card-text\">bullshit article</p></div></div><div class=\"article-card\"><h1 class=\"article-card-title\">Article 2</h1><span class=\"article-card-preview\">Preview for article 2.</span><a class=\"article-card-link\" href=\"http://yahoo.com\">yahoo!</a>no comments</div><a class=\"mailme-btn\" href=\"mailto:egotraumatic@example.com\">Mail me</a></body></html>"))
 	})
+	It("renders templates into io.Writer", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/greeting",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("p", Attributes(), Content(Text("Hello, "), TextInj("name"), Text("!")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		var sb strings.Builder
+		r = univ.RenderTo(&sb, "/greeting", map[string]interface{}{"name": "John"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(sb.String()).To(Equal("<p>Hello, John!</p>"))
+		r = univ.RenderTo(failingWriter{}, "/greeting", map[string]interface{}{"name": "John"})
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("can't write rendered template: connection reset"))
+	})
+	It("renders conditional content and attributes", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/menu/item",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("li",
+					Attributes(
+						If("active", Attributes(Attr("class", "active")), nil)),
+					Content(
+						If("link",
+							Content(Tag("a", Attributes(AttrInjection("href", "link")), Content(TextInj("title")))),
+							Content(TextInj("title"))),
+						Unless("items", Content(Text(" (empty)")), nil)))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/menu/item", map[string]interface{}{
+			"active": true,
+			"link":   "/home",
+			"title":  "Home",
+			"items":  []string{"news"},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<li class=\"active\"><a href=\"/home\">Home</a></li>"))
+		rendered, r = univ.Render("/menu/item", map[string]interface{}{
+			"active": false,
+			"link":   "",
+			"title":  "Archive",
+			"items":  []string{},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<li>Archive (empty)</li>"))
+		r = univ.Validate("/menu/item", map[string]interface{}{"link": "/home"})
+		Expect(report.ToString(r)).To(ContainSubstring("param \"title\" not provided"))
+	})
+	It("renders boolean and optional attributes", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/input",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("input",
+					Attributes(
+						Attr("type", "checkbox"),
+						BoolAttr("checked", "checked"),
+						BoolAttr("disabled", "disabled"),
+						OptionalAttrInjection("title", "hint")),
+					Content())))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/input", map[string]interface{}{
+			"checked":  true,
+			"disabled": false,
+			"hint":     "Subscribe",
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<input type=\"checkbox\" checked title=\"Subscribe\"/>"))
+		rendered, r = univ.Render("/input", map[string]interface{}{"hint": ""})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<input type=\"checkbox\"/>"))
+		_, r = univ.Render("/input", map[string]interface{}{"checked": "yes"})
+		Expect(report.ToString(r)).To(ContainSubstring("boolean attribute \"checked\" param \"checked\" should be a boolean"))
+		checked, hint := true, "Subscribe"
+		rendered, r = univ.Render("/input", struct {
+			Checked  *bool   `gt:"checked"`
+			Disabled *bool   `gt:"disabled"`
+			Hint     *string `gt:"hint"`
+		}{Checked: &checked, Hint: &hint})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<input type=\"checkbox\" checked title=\"Subscribe\"/>"))
+		params := map[string]interface{}{"checked": nil, "disabled": (*bool)(nil), "hint": nil}
+		Expect(univ.Validate("/input", params).HasErrors()).To(BeFalse())
+		rendered, r = univ.Render("/input", params)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<input type=\"checkbox\"/>"))
+		rendered, r = univ.Render("/input", struct {
+			Hint *string `gt:"hint"`
+		}{})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<input type=\"checkbox\"/>"))
+	})
+	It("formats non-string values of injections", func() {
+		limbo := newLimbo()
+		limbo.Formatter("price", func(v interface{}) (string, error) {
+			cents, ok := v.(int)
+			if !ok {
+				return "", fmt.Errorf("price should be an int, got: %T", v)
+			}
+			return fmt.Sprintf("$%d.%02d", cents/100, cents%100), nil
+		})
+		limbo.Template(
+			"/product",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("div",
+					Attributes(
+						AttrInjection("data-id", "id"),
+						OptionalAttrInjection("data-weight", "weight")),
+					Content(
+						TextInj("available"), Text(" "),
+						TextInj("updated"), Text(" "),
+						TextInj("color"), Text(" "),
+						TextInjFormat("price", "price")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		updated, err := time.Parse(time.RFC3339, "2022-05-02T10:11:12Z")
+		Expect(err).NotTo(HaveOccurred())
+		rendered, r := univ.Render("/product", map[string]interface{}{
+			"id":        42,
+			"weight":    1.5,
+			"available": true,
+			"updated":   updated,
+			"color":     color("red"),
+			"price":     1999,
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<div data-id=\"42\" data-weight=\"1.5\">true 2022-05-02T10:11:12Z &lt;red&gt; $19.99</div>"))
+		_, r = univ.Render("/product", map[string]interface{}{
+			"id":        []int{42},
+			"available": true,
+			"updated":   updated,
+			"color":     color("red"),
+			"price":     "free",
+		})
+		Expect(report.ToString(r)).To(ContainSubstring("attribute value injection \"id\" can't be formatted: unsupported value type []int"))
+		_, r = univ.Render("/product", map[string]interface{}{
+			"id":        42,
+			"available": true,
+			"updated":   updated,
+			"color":     color("red"),
+			"price":     "free",
+		})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"price\" can't be formatted: price should be an int, got: string"))
+		limbo.Template(
+			"/broken",
+			WithStylesheet("main"),
+			WithContent(TextInjFormat("price", "currency")))
+		_, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("formatter \"currency\" for text injection \"price\" not registered"))
+	})
+	It("resolves layouts slots into the extending templates", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/layout/main",
+			WithStylesheet("main"),
+			WithLayout(
+				Doctype(),
+				Tag("html",
+					Attributes(),
+					Content(
+						Tag("head",
+							Attributes(),
+							Content(
+								Tag("title", Attributes(), Content(Slot("title", Content(Text("Untitled"))))),
+								Slot("head-extra", nil))),
+						Tag("body",
+							Attributes(),
+							Content(Slot("main", Content(Text("nothing here")))))))))
+		limbo.Template(
+			"/layout/article",
+			Extends("/layout/main",
+				Fill("main", Content(
+					Tag("article", Attributes(), Content(Slot("article", nil))),
+					Tag("aside", Attributes(), Content(Slot("aside", Content(Text("no related")))))))))
+		limbo.Template(
+			"/article",
+			Extends("/layout/article",
+				Fill("title", Content(TextInj("title"))),
+				Fill("head-extra", Content(Tag("script", Attributes(), Content(Text("var title = \""), TextInj("title"), Text("\";"))))),
+				Fill("article", Content(Tag("h1", Attributes(), Content(TextInj("title"))))),
+				Fill("footer", Content(Text("unused")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(report.ToString(r)).To(ContainSubstring("slot \"footer\" filled by template \"/article\" is not placed by its layouts"))
+		rendered, r := univ.Render("/layout/main", nil)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<!DOCTYPE html><html><head><title>Untitled</title></head><body>nothing here</body></html>"))
+		rendered, r = univ.Render("/article", map[string]interface{}{"title": "Tom & Jerry"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<!DOCTYPE html><html><head><title>Tom &amp; Jerry</title><script>var title = \"Tom \\u0026 Jerry\";</script></head><body><article><h1>Tom &amp; Jerry</h1></article><aside>no related</aside></body></html>"))
+		limbo.Template("/loop/a", Extends("/loop/b"))
+		limbo.Template("/loop/b", Extends("/loop/a"))
+		_, r = limbo.Universe()
+		Expect(report.ToString(r)).To(ContainSubstring("layouts extension cycle: /loop/a -> /loop/b -> /loop/a"))
+	})
+	It("falls back to static props and template props defaults", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/btn",
+			WithStylesheet("main"),
+			WithProps(
+				Prop("variant", "primary"),
+				Prop("text", "Click me")),
+			WithContent(
+				Tag("a",
+					Attributes(
+						AttrInjection("class", "variant"),
+						AttrInjection("href", "href")),
+					Content(TextInj("text")))))
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				TemplatePlacementWith("/btn", "mailme", StaticProps{"href": "mailto:me@example.com", "text": "Mail me"}),
+				TemplatePlacementWith("/btn", Auto(), StaticProps{"variant": "secondary"}),
+				TemplatePlacement("/btn", "home")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/page", map[string]interface{}{
+			"href": "/about",
+			"home": map[string]interface{}{"href": "/", "text": "Home"},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a class=\"primary\" href=\"mailto:me@example.com\">Mail me</a><a class=\"secondary\" href=\"/about\">Click me</a><a class=\"primary\" href=\"/\">Home</a>"))
+		r = univ.Validate("/page", map[string]interface{}{"home": map[string]interface{}{}})
+		Expect(report.ToString(r)).To(And(
+			ContainSubstring("param \"href\" not provided"),
+			ContainSubstring("param \"home.href\" not provided"),
+			Not(ContainSubstring("mailme")),
+			Not(ContainSubstring("text")),
+			Not(ContainSubstring("variant"))))
+		schema, _ := univ.Schema("/btn")
+		Expect(schema.Params).To(Equal([]Param{
+			{Key: "variant", Kind: AttrParam, Optional: true, Default: "primary"},
+			{Key: "href", Kind: AttrParam},
+			{Key: "text", Kind: TextParam, Optional: true, Default: "Click me"},
+		}))
+	})
+	It("prefers placement static props to the props of the placing template", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/btn",
+			WithStylesheet("main"),
+			WithProps(Prop("size", "small")),
+			WithContent(Tag("a", Attributes(AttrInjection("class", "variant"), AttrInjection("data-size", "size")), Content())))
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithProps(
+				Prop("variant", "page-default"),
+				Prop("size", "page-size")),
+			WithContent(
+				TemplatePlacementWith("/btn", Auto(), StaticProps{"variant": "secondary"}),
+				Tag("p", Attributes(AttrInjection("class", "variant")), Content())))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/page", map[string]interface{}{})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a class=\"secondary\" data-size=\"small\"></a><p class=\"page-default\"></p>"))
+		rendered, r = univ.Render("/page", map[string]interface{}{"variant": "explicit"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a class=\"explicit\" data-size=\"small\"></a><p class=\"explicit\"></p>"))
+		schema, _ := univ.Schema("/page")
+		Expect(schema.Params).To(Equal([]Param{
+			{Key: "variant", Kind: AttrParam, Optional: true, Default: "secondary"},
+			{Key: "size", Kind: AttrParam, Optional: true, Default: "small"},
+		}))
+	})
+	It("places children content into the placed template", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/panel",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("section",
+					Attributes(Attr("class", "panel")),
+					Content(
+						Tag("h2", Attributes(), Content(TextInj("title"))),
+						Tag("div", Attributes(Attr("class", "panel-body")), Content(Children()))))))
+		limbo.Template(
+			"/modal",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("dialog",
+					Attributes(),
+					Content(
+						TemplatePlacementWithChildren("/panel", Auto(), Content(
+							Children(),
+							Tag("button", Attributes(), Content(Text("Close")))))))))
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				TemplatePlacementWithChildren("/modal", "modal", Content(
+					Tag("p", Attributes(), Content(TextInj("message"))))),
+				TemplatePlacement("/panel", "empty")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/page", map[string]interface{}{
+			"message": "Saved!",
+			"modal":   map[string]interface{}{"title": "Notice"},
+			"empty":   map[string]interface{}{"title": "Empty"},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<dialog><section class=\"panel\"><h2>Notice</h2><div class=\"panel-body\"><p>Saved!</p><button>Close</button></div></section></dialog><section class=\"panel\"><h2>Empty</h2><div class=\"panel-body\"></div></section>"))
+	})
+	It("repeats rules with loop metadata and else rule", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/list",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("ul",
+					Attributes(),
+					Content(
+						RepeatWith(
+							"items",
+							Tag("li",
+								Attributes(
+									If("$first", Attributes(Attr("class", "first")), nil),
+									If("$last", Attributes(Attr("class", "last")), nil),
+									If("$odd", Attributes(Attr("data-odd", "true")), nil)),
+								Content(TextInj("$number"), Text(". "), TextInj("title"))),
+							Else(Tag("li", Attributes(), Content(Text("no items"))))))),
+				Repeat("items", TemplatePlacement("/index", Auto()))))
+		limbo.Template(
+			"/index",
+			WithStylesheet("main"),
+			WithContent(TextInj("$index")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		items := []map[string]interface{}{{"title": "First"}, {"title": "Second"}, {"title": "Third"}}
+		rendered, r := univ.Render("/list", map[string]interface{}{"items": items})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<ul><li class=\"first\">1. First</li><li data-odd=\"true\">2. Second</li><li class=\"last\">3. Third</li></ul>012"))
+		Expect(univ.Validate("/list", map[string]interface{}{"items": items}).HasErrors()).To(BeFalse())
+		rendered, r = univ.Render("/list", map[string]interface{}{"items": []map[string]interface{}{}})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<ul><li>no items</li></ul>"))
+		_, r = univ.Render("/list", map[string]interface{}{})
+		Expect(report.ToString(r)).To(ContainSubstring("repeatable params \"items\" not provided"))
+		schema, _ := univ.Schema("/list")
+		Expect(schema.Params[0]).To(Equal(Param{
+			Key:      "items",
+			Kind:     ListParam,
+			Optional: true,
+			Schema: &Schema{Params: []Param{
+				{Key: "$first", Kind: ConditionParam, Optional: true, Schema: &Schema{Params: []Param{}}, Else: &Schema{Params: []Param{}}},
+				{Key: "$last", Kind: ConditionParam, Optional: true, Schema: &Schema{Params: []Param{}}, Else: &Schema{Params: []Param{}}},
+				{Key: "$odd", Kind: ConditionParam, Optional: true, Schema: &Schema{Params: []Param{}}, Else: &Schema{Params: []Param{}}},
+				{Key: "title", Kind: TextParam},
+			}},
+			Else: &Schema{Params: []Param{}},
+		}))
+	})
+	It("repeats rules over slices of scalars", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/tags",
+			WithStylesheet("main"),
+			WithContent(
+				Repeat("tags", Tag("a", Attributes(AttrInjection("href", "$item")), Content(TextInj("$item")))),
+				Repeat("counts", Tag("i", Attributes(), Content(TextInj("$item")))),
+				RepeatWith("mixed", TextInj("$item"), Else(Text("none")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		params := map[string]interface{}{
+			"tags":   []string{"/go", "/html"},
+			"counts": []int{1, 2},
+			"mixed":  []interface{}{"a", 1, true},
+		}
+		rendered, r := univ.Render("/tags", params)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a href=\"/go\">/go</a><a href=\"/html\">/html</a><i>1</i><i>2</i>a1true"))
+		Expect(univ.Validate("/tags", params).HasErrors()).To(BeFalse())
+		params["mixed"] = [0]float64{}
+		rendered, r = univ.Render("/tags", params)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(HaveSuffix("</i>none"))
+	})
+	It("repeats rules over maps in the given order", func() {
+		limbo := newLimbo()
+		entry := Content(Tag("dt", Attributes(), Content(TextInj("$key"))), Tag("dd", Attributes(), Content(TextInj("$value"))))
+		limbo.Template(
+			"/dl",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("dl", Attributes(), Content(RepeatMap("sorted", entry, SortedKeys()))),
+				Tag("dl", Attributes(), Content(RepeatMap("provided", entry, KeysOrder("order")))),
+				Tag("dl", Attributes(), Content(RepeatMap("custom", entry, CustomOrder(func(a, b string) bool { return a > b })))),
+				RepeatMap("users", Tag("b", Attributes(), Content(TextInj("$key"), Text(":"), TextInj("name"))), SortedKeys())))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		m := map[string]string{"b": "2", "a": "1", "c": "3"}
+		params := map[string]interface{}{
+			"sorted":   m,
+			"provided": m,
+			"order":    []string{"c", "a"},
+			"custom":   m,
+			"users":    map[string]map[string]interface{}{"u2": {"name": "Jane"}, "u1": {"name": "John"}},
+		}
+		rendered, r := univ.Render("/dl", params)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal(
+			"<dl><dt>a</dt><dd>1</dd><dt>b</dt><dd>2</dd><dt>c</dt><dd>3</dd></dl>" +
+				"<dl><dt>c</dt><dd>3</dd><dt>a</dt><dd>1</dd><dt>b</dt><dd>2</dd></dl>" +
+				"<dl><dt>c</dt><dd>3</dd><dt>b</dt><dd>2</dd><dt>a</dt><dd>1</dd></dl>" +
+				"<b>u1:John</b><b>u2:Jane</b>"))
+		Expect(univ.Validate("/dl", params).HasErrors()).To(BeFalse())
+		schema, _ := univ.Schema("/dl")
+		Expect(schema.Params[1]).To(Equal(Param{Key: "provided", Kind: MapParam, Schema: &Schema{Params: []Param{}}}))
+		Expect(schema.Params[2]).To(Equal(Param{Key: "order", Kind: ListParam, Schema: &Schema{Params: []Param{}}}))
+		Expect(schema.Params[4].Schema.Params).To(Equal([]Param{{Key: "name", Kind: TextParam}}))
+		params["users"] = map[string]interface{}{"u1": map[string]interface{}{}}
+		Expect(report.ToString(univ.Validate("/dl", params))).To(ContainSubstring("param \"users[u1].name\" not provided"))
+		params["users"] = map[string]interface{}{}
+		params["order"] = []interface{}{"c", "a"}
+		Expect(univ.Validate("/dl", params).HasErrors()).To(BeFalse())
+		rendered, r = univ.Render("/dl", params)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(ContainSubstring("<dl><dt>c</dt><dd>3</dd><dt>a</dt><dd>1</dd><dt>b</dt><dd>2</dd></dl>"))
+		params["order"] = []interface{}{"c", []int{1}}
+		Expect(report.ToString(univ.Validate("/dl", params))).To(ContainSubstring("param \"order[1].$item\" should be a string"))
+		_, r = univ.Render("/dl", params)
+		Expect(report.ToString(r)).To(ContainSubstring("repeatable params \"provided\": keys order \"order\" key 1: unsupported value type []int"))
+		params["order"] = "c,a"
+		Expect(report.ToString(univ.Validate("/dl", params))).To(ContainSubstring("param \"order\" should be a slice, got: string"))
+		_, r = univ.Render("/dl", params)
+		Expect(report.ToString(r)).To(ContainSubstring("keys order \"order\" should be a slice, got: string"))
+		delete(params, "order")
+		_, r = univ.Render("/dl", params)
+		Expect(report.ToString(r)).To(ContainSubstring("keys order \"order\" not provided at /dl > dl"))
+		rendered, r = univ.Render("/dl", params, Lenient())
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(HavePrefix("<dl><dt>a</dt><dd>1</dd><dt>b</dt><dd>2</dd><dt>c</dt><dd>3</dd></dl><dl></dl>"))
+		Expect(report.ToString(r)).To(ContainSubstring("keys order \"order\" not provided"))
+		params["sorted"] = []string{"a"}
+		_, r = univ.Render("/dl", params)
+		Expect(report.ToString(r)).To(ContainSubstring("repeatable params \"sorted\" should be a map with string keys, got: []string"))
+	})
+	It("switches templates by the discriminator value", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/card",
+			WithStylesheet("main"),
+			WithContent(
+				Switch("type",
+					Case("video", "/card/video"),
+					Case("article", "/card/article"),
+					DefaultCase("/card/generic"))))
+		limbo.Template(
+			"/strict-card",
+			WithStylesheet("main"),
+			WithContent(Switch("type", Case("video", "/card/video"))))
+		limbo.Template("/card/video", WithStylesheet("main"), WithContent(Tag("video", Attributes(AttrInjection("src", "src")), Content())))
+		limbo.Template("/card/article", WithStylesheet("main"), WithContent(Tag("article", Attributes(), Content(TextInj("title")))))
+		limbo.Template("/card/generic", WithStylesheet("main"), WithContent(Text("generic")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/card", map[string]interface{}{"type": "video", "src": "/v.mp4"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<video src=\"/v.mp4\"></video>"))
+		rendered, r = univ.Render("/card", map[string]interface{}{"type": "article", "title": "Title", "src": "/v.mp4"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<article>Title</article>"))
+		rendered, r = univ.Render("/card", map[string]interface{}{"type": "podcast"})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("generic"))
+		rendered, r = univ.Render("/card", map[string]interface{}{})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("generic"))
+		_, r = univ.Render("/strict-card", map[string]interface{}{"type": "podcast"})
+		Expect(report.ToString(r)).To(ContainSubstring("switch \"type\": no case for \"podcast\""))
+		_, r = univ.Render("/strict-card", map[string]interface{}{})
+		Expect(report.ToString(r)).To(ContainSubstring("switch discriminator \"type\" not provided"))
+		rendered, err := univ.RenderE("/strict-card", nil, Lenient())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(Equal(""))
+		Expect(univ.Validate("/card", map[string]interface{}{"type": "article", "title": "Title"}).HasErrors()).To(BeFalse())
+		Expect(report.ToString(univ.Validate("/card", map[string]interface{}{"type": "article"}))).To(ContainSubstring("param \"title\" not provided"))
+		Expect(report.ToString(univ.Validate("/strict-card", map[string]interface{}{"type": color("video")}))).To(ContainSubstring("param \"type\": no case for \"<video>\""))
+		schema, _ := univ.Schema("/card")
+		Expect(schema.Params).To(HaveLen(1))
+		Expect(schema.Params[0].Kind).To(Equal(SwitchParam))
+		Expect(schema.Params[0].Optional).To(BeTrue())
+		Expect(schema.Params[0].Cases).To(HaveKey("video"))
+		Expect(schema.Params[0].Cases["article"].Params).To(Equal([]Param{{Key: "title", Kind: TextParam}}))
+		Expect(schema.Params[0].Else.Template).To(Equal("/card/generic"))
+	})
+	It("fails on switch with duplicate cases", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/card",
+			WithStylesheet("main"),
+			WithContent(
+				Switch("type",
+					Case("video", "/card/generic"),
+					Case("video", "/card/generic"),
+					DefaultCase("/card/generic"),
+					DefaultCase("/card/generic"))))
+		limbo.Template("/card/generic", WithStylesheet("main"), WithContent(Text("generic")))
+		_, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("switch \"type\": case \"video\" is already specified"))
+		Expect(report.ToString(r)).To(ContainSubstring("switch \"type\": default case is already specified"))
+	})
+	It("reports all missing templates, referenced by the rules", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				TemplatePlacement("/header", "header"),
+				Variant("/comments/empty", map[string]string{"top": "/comments/top", "all": "/comments/all"}),
+				Switch("type", Case("video", "/card/video"), Case("article", "/card/article"), DefaultCase("/card/generic")),
+				TemplateInjection("widget", "/widget/clock", "/widget/weather")))
+		limbo.Template("/comments/all", WithStylesheet("main"), WithContent(Text("all")))
+		limbo.Template("/card/generic", WithStylesheet("main"), WithContent(Text("generic")))
+		limbo.Template("/widget/clock", WithStylesheet("main"), WithContent(Text("clock")))
+		univ, r := limbo.Universe()
+		Expect(univ).To(BeNil())
+		Expect(r.HasErrors()).To(BeTrue())
+		rendered := report.ToString(r)
+		Expect(rendered).To(ContainSubstring("template \"/page\" references"))
+		Expect(rendered).To(ContainSubstring("placement \"header\": template \"/header\" doesn't exist"))
+		Expect(rendered).To(ContainSubstring("variant default: template \"/comments/empty\" doesn't exist"))
+		Expect(rendered).To(ContainSubstring("variant \"top\": template \"/comments/top\" doesn't exist"))
+		Expect(rendered).NotTo(ContainSubstring("/comments/all\" doesn't exist"))
+		Expect(rendered).To(ContainSubstring("switch \"type\": template \"/card/video\" doesn't exist"))
+		Expect(rendered).To(ContainSubstring("switch \"type\": template \"/card/article\" doesn't exist"))
+		Expect(rendered).To(ContainSubstring("template injection \"widget\": template \"/widget/weather\" doesn't exist"))
+	})
+	It("injects only allowed templates", func() {
+		limbo := newLimbo()
+		limbo.Template("/sidebar", WithStylesheet("main"), WithContent(TemplateInjection("widget", "/widget/clock")))
+		limbo.Template("/widget/clock", WithStylesheet("main"), WithContent(TextInj("time")))
+		limbo.Template("/admin", WithStylesheet("main"), WithContent(Text("admin")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		clock := map[string]interface{}{"widget": map[string]interface{}{"name": "/widget/clock", "params": map[string]interface{}{"time": "12:00"}}}
+		rendered, r := univ.Render("/sidebar", clock)
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("12:00"))
+		admin := map[string]interface{}{"widget": map[string]interface{}{"name": "/admin", "params": map[string]interface{}{}}}
+		_, r = univ.Render("/sidebar", admin)
+		Expect(report.ToString(r)).To(ContainSubstring("template \"/admin\" is not allowed for injection \"widget\""))
+		Expect(report.ToString(univ.Validate("/sidebar", admin))).To(ContainSubstring("param \"widget.name\": template \"/admin\" is not allowed"))
+		schema, _ := univ.Schema("/sidebar")
+		Expect(schema.Params).To(Equal([]Param{{Key: "widget", Kind: InjectionParam, Allowed: []string{"/widget/clock"}}}))
+	})
+	It("reports unconditional placement cycles", func() {
+		limbo := newLimbo()
+		limbo.Template("/a", WithStylesheet("main"), WithContent(Text("a"), TemplatePlacement("/b", Auto())))
+		limbo.Template("/b", WithStylesheet("main"), WithContent(Tag("div", Attributes(), Content(TemplatePlacement("/a", "a")))))
+		limbo.Template("/self", WithStylesheet("main"), WithContent(TemplatePlacement("/self", Auto())))
+		limbo.Template(
+			"/comment",
+			WithStylesheet("main"),
+			WithContent(
+				TextInj("text"),
+				Repeat("replies", TemplatePlacement("/comment", Auto())),
+				If("parent", Content(TemplatePlacement("/comment", "parent")), nil)))
+		limbo.Template(
+			"/framed",
+			WithStylesheet("main"),
+			WithContent(TemplatePlacementWithChildren("/panel", Auto(), Content(TemplatePlacement("/framed", Auto())))))
+		limbo.Template("/panel", WithStylesheet("main"), WithContent(Tag("div", Attributes(), Content(Children()))))
+		univ, r := limbo.Universe()
+		Expect(univ).To(BeNil())
+		Expect(report.ToString(r)).To(ContainSubstring("templates placement cycle: /framed -> /framed"))
+		Expect(report.ToString(r)).To(ContainSubstring("templates placement cycle: /a -> /b -> /a"))
+		Expect(report.ToString(r)).To(ContainSubstring("templates placement cycle: /self -> /self"))
+		Expect(report.ToString(r)).NotTo(ContainSubstring("/comment ->"))
+	})
+	It("limits nesting depth of the placed and injected templates", func() {
+		limbo := newLimbo()
+		limbo.MaxDepth(3)
+		limbo.Template(
+			"/thread",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("p", Attributes(), Content(TextInj("text"))),
+				If("reply", Content(TemplateInjection("reply")), nil)))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		thread := func(texts ...string) map[string]interface{} {
+			var params map[string]interface{}
+			for i := len(texts) - 1; i >= 0; i-- {
+				current := map[string]interface{}{"text": texts[i]}
+				if params != nil {
+					current["reply"] = map[string]interface{}{"name": "/thread", "params": params}
+				}
+				params = current
+			}
+			return params
+		}
+		rendered, r := univ.Render("/thread", thread("1", "2", "3"))
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<p>1</p><p>2</p><p>3</p>"))
+		_, r = univ.Render("/thread", thread("1", "2", "3", "4"))
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("template \"/thread\" injection \"reply\" exceeds max nesting depth 3"))
+		rendered, r = univ.Render("/thread", thread("1", "2", "3"))
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<p>1</p><p>2</p><p>3</p>"))
+	})
+	It("reports rule locations with the rules path and the source position", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/layout/test",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("html", Attributes(), Content(
+					Tag("body", Attributes(), Content(
+						Repeat("articles", TemplatePlacement("/card/article", Auto()))))))))
+		limbo.Template(
+			"/card/article",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a", Attributes(AttrInjection("href", "link")), Content(TextInj("title")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		articles := []map[string]interface{}{{"title": "First", "link": "/first"}, {"title": "Second"}}
+		_, r = univ.Render("/layout/test", map[string]interface{}{"articles": articles})
+		Expect(r.HasErrors()).To(BeTrue())
+		rendered := report.ToString(r)
+		Expect(rendered).To(ContainSubstring("attribute value injection \"link\" not provided at /layout/test > html > body > Repeat(articles)[1] > /card/article > a[href] (/"))
+		Expect(rendered).To(MatchRegexp(`a\[href\] \(\S+/gt_test\.go:\d+\)`))
+		limbo.Template(
+			"/broken",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("p", Attributes(), Content(
+					If("visible", TextInj("title", Filters("shout")), nil)))))
+		_, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("filter \"shout\" for injection \"title\" not registered at /broken > p > If(visible) ("))
+		limbo = newLimbo()
+		limbo.Template(
+			"/siblings",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("html", Attributes(), Content(
+					Tag("body", Attributes(), Content(
+						Tag("a", Attributes(AttrInjection("href", "u"), BoolAttr("hidden", "h"), AttrInjection("title", "t")), Content(TextInj("x"))),
+						Tag("p", Attributes(), Content(TextInj("y")))))))))
+		univ, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		_, r = univ.Render("/siblings", map[string]interface{}{"u": "/"})
+		Expect(report.ToString(r)).To(ContainSubstring("attribute value injection \"t\" not provided at /siblings > html > body > a[title] ("))
+		_, r = univ.Render("/siblings", map[string]interface{}{"u": "/", "t": "T"})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"x\" not provided at /siblings > html > body > a ("))
+		_, r = univ.Render("/siblings", map[string]interface{}{"u": "/", "t": "T", "x": "X"})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"y\" not provided at /siblings > html > body > p ("))
+		limbo.Template(
+			"/siblings-filter",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("div", Attributes(AttrInjection("id", "id", Filters("lower"))), Content(
+					Tag("p", Attributes(), Content(TextInj("y", Filters("missing"))))))))
+		_, r = limbo.Universe()
+		Expect(report.ToString(r)).To(ContainSubstring("filter \"missing\" for injection \"y\" not registered at /siblings-filter > div > p ("))
+		limbo = newLimbo()
+		limbo.Template(
+			"/unless",
+			WithStylesheet("main"),
+			WithContent(Unless("hidden", Content(TextInj("x")), Content(TextInj("y")))))
+		univ, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		_, r = univ.Render("/unless", map[string]interface{}{})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"x\" not provided at /unless > Unless(hidden) ("))
+		_, r = univ.Render("/unless", map[string]interface{}{"hidden": true})
+		Expect(report.ToString(r)).To(ContainSubstring("text injection \"y\" not provided at /unless > Unless(hidden) else ("))
+	})
+	It("returns typed errors instead of panics on bad params", func() {
+		limbo := newLimbo()
+		limbo.Formatter("broken", func(v interface{}) (string, error) {
+			panic("broken formatter")
+		})
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("h1", Attributes(), Content(TextInj("title"))),
+				If("author", TemplatePlacement("/author", "author"), nil),
+				If("tags", Repeat("tags", TextInj("$item")), nil),
+				If("widget", TemplateInjection("widget"), nil),
+				If("price", TextInjFormat("price", "broken"), nil)))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(TextInj("name")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, err := univ.RenderE("/page", map[string]interface{}{"title": "Title", "tags": []string{"a", "b"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(Equal("<h1>Title</h1>ab"))
+		_, err = univ.RenderE("/page", map[string]interface{}{})
+		var missing *MissingParamError
+		Expect(errors.As(err, &missing)).To(BeTrue())
+		Expect(missing.Rule).To(Equal("text injection"))
+		Expect(missing.Key).To(Equal("title"))
+		Expect(missing.Location).To(HavePrefix("/page > h1 ("))
+		_, err = univ.RenderE("/page", map[string]interface{}{"title": "Title", "author": "Jane"})
+		var typeErr *ParamTypeError
+		Expect(errors.As(err, &typeErr)).To(BeTrue())
+		Expect(typeErr.Key).To(Equal("author"))
+		Expect(typeErr.Value).To(Equal("Jane"))
+		Expect(err.Error()).To(HavePrefix("template placement params \"author\" should be a map or a struct, got: string at /page > If(author) ("))
+		_, err = univ.RenderE("/page", map[string]interface{}{"title": "Title", "tags": "a,b"})
+		Expect(errors.As(err, &typeErr)).To(BeTrue())
+		Expect(typeErr.Expected).To(Equal("a slice"))
+		widget := map[string]interface{}{"name": "/widget", "params": map[string]interface{}{}}
+		_, err = univ.RenderE("/page", map[string]interface{}{"title": "Title", "widget": widget})
+		var unknown *UnknownTemplateError
+		Expect(errors.As(err, &unknown)).To(BeTrue())
+		Expect(unknown.Name).To(Equal("/widget"))
+		_, err = univ.RenderE("/unknown", nil)
+		Expect(err).To(MatchError(&UnknownTemplateError{Name: "/unknown"}))
+		_, err = univ.RenderE("/page", map[string]interface{}{"title": "Title", "price": 10})
+		Expect(err).To(MatchError(ContainSubstring("rendering panicked: broken formatter at /page > If(price)")))
+		_, r = univ.Render("/page", map[string]interface{}{"title": "Title", "price": 10})
+		Expect(report.ToString(r)).To(ContainSubstring("rendering panicked: broken formatter"))
+	})
+	It("considers nil params of placements and repeatables as not provided", func() {
+		type author struct {
+			Name string `gt:"name"`
+		}
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				TemplatePlacement("/author", "author"),
+				RepeatWith("tags", TextInj("$item"), Else(Text("no tags")))))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(TextInj("name")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		for _, nilAuthor := range []interface{}{nil, (*author)(nil)} {
+			params := map[string]interface{}{"author": nilAuthor, "tags": nil}
+			_, err := univ.RenderE("/page", params)
+			var missing *MissingParamError
+			Expect(errors.As(err, &missing)).To(BeTrue())
+			Expect(missing.Key).To(Equal("author"))
+			Expect(report.ToString(univ.Validate("/page", params))).To(ContainSubstring("param \"author\" not provided"))
+			rendered, err := univ.RenderE("/page", params, Lenient())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rendered).To(Equal("no tags"))
+		}
+	})
+	It("renders missing params empty or with placeholder in lenient mode", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a", Attributes(AttrInjection("title", "hint")), Content(TextInj("title"))),
+				TemplatePlacement("/author", "author"),
+				Repeat("tags", TextInj("$item")),
+				TemplateInjection("widget"),
+				Tag("p", Attributes(), Content(TextInj("footer")))))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(TextInj("name")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		params := map[string]interface{}{"title": "Title", "footer": "<footer>"}
+		_, r = univ.Render("/page", params)
+		Expect(r.HasErrors()).To(BeTrue())
+		_, r = univ.Render("/page", params, Strict())
+		Expect(report.ToString(r)).To(ContainSubstring("attribute value injection \"hint\" not provided"))
+		rendered, r := univ.Render("/page", params, Lenient())
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a title=\"\">Title</a><p>&lt;footer&gt;</p>"))
+		warnings := report.ToString(r)
+		Expect(warnings).To(ContainSubstring("attribute value injection \"hint\" not provided at /page > a[title]"))
+		Expect(warnings).To(ContainSubstring("template placement params \"author\" not provided"))
+		Expect(warnings).To(ContainSubstring("repeatable params \"tags\" not provided"))
+		Expect(warnings).To(ContainSubstring("template injection \"widget\" not provided"))
+		rendered, err := univ.RenderE("/page", map[string]interface{}{"author": map[string]interface{}{}}, LenientWith("<n/a>"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(Equal("<a title=\"&lt;n/a&gt;\">&lt;n/a&gt;</a>&lt;n/a&gt;<p>&lt;n/a&gt;</p>"))
+		_, err = univ.RenderE("/page", map[string]interface{}{"title": "Title", "hint": "Hint", "author": "Jane"}, Lenient())
+		Expect(err).To(MatchError(ContainSubstring("template placement params \"author\" should be a map or a struct")))
+	})
+	It("renders with context, lazy params and context-aware functions", func() {
+		type ctxKey struct{}
+		limbo := newLimbo()
+		limbo.FormatterContext("locale", func(ctx context.Context, v interface{}) (string, error) {
+			return fmt.Sprintf("%s:%v", ctx.Value(ctxKey{}), v), nil
+		})
+		limbo.FilterContext("suffix", func(ctx context.Context, v interface{}, args ...string) (interface{}, error) {
+			return fmt.Sprintf("%v%s", v, ctx.Value(ctxKey{})), nil
+		})
+		limbo.Template(
+			"/list",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("h1", Attributes(), Content(TextInjFormat("title", "locale"))),
+				Tag("ul", Attributes(), Content(
+					Repeat("items", TemplatePlacement("/item", Auto()))))))
+		limbo.Template(
+			"/item",
+			WithStylesheet("main"),
+			WithContent(Tag("li", Attributes(), Content(TextInj("title", Filters("suffix"))))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		evaluated := 0
+		params := map[string]interface{}{
+			"title": "Items",
+			"items": LazyParam(func(ctx context.Context) (interface{}, error) {
+				evaluated++
+				return []map[string]interface{}{{"title": "a"}, {"title": "b"}}, nil
+			}),
+		}
+		Expect(univ.Validate("/list", params).HasErrors()).To(BeFalse())
+		Expect(evaluated).To(Equal(0))
+		ctx := context.WithValue(context.Background(), ctxKey{}, "en")
+		var sb strings.Builder
+		r, err := univ.RenderContext(ctx, &sb, "/list", params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(sb.String()).To(Equal("<h1>en:Items</h1><ul><li>aen</li><li>ben</li></ul>"))
+		Expect(evaluated).To(Equal(1))
+		params["items"] = LazyParam(func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("timeout")
+		})
+		_, err = univ.RenderContext(ctx, &strings.Builder{}, "/list", params)
+		Expect(err).To(MatchError(ContainSubstring("repeatable params \"items\": lazy param failed: timeout at /list > ul")))
+		ctx, cancel := context.WithCancel(ctx)
+		params["items"] = LazyParam(func(context.Context) (interface{}, error) {
+			cancel() // client disconnected while the items were fetched
+			return []map[string]interface{}{{"title": "a"}, {"title": "b"}}, nil
+		})
+		r, err = univ.RenderContext(ctx, &strings.Builder{}, "/list", params)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(err.Error()).To(HavePrefix("rendering aborted at /list > ul ("))
+		Expect(report.ToString(r)).To(ContainSubstring("rendering aborted"))
+		_, err = univ.RenderContext(ctx, &strings.Builder{}, "/list", params)
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(err.Error()).To(Equal("rendering aborted at /list: context canceled"))
+		limbo.Template(
+			"/feed",
+			WithStylesheet("main"),
+			WithContent(
+				If("items", Repeat("items", TextInj("$item")), nil),
+				Variant("/none", map[string]string{"featured": "/item"})))
+		limbo.Template("/none", WithStylesheet("main"), WithContent(Text("none")))
+		univ, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		evaluated = 0
+		rendered, err := univ.RenderE("/feed", map[string]interface{}{
+			"items": LazyParam(func(context.Context) (interface{}, error) {
+				evaluated++
+				return []string{"a", "b"}, nil
+			}),
+			"featured": LazyParam(func(context.Context) (interface{}, error) {
+				return nil, nil
+			}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(Equal("abnone"))
+		Expect(evaluated).To(Equal(1))
+		limbo.Template(
+			"/dashboard",
+			WithStylesheet("main"),
+			WithContent(
+				RepeatMap("stats", Content(TextInj("$key"), Text("="), TextInj("$value"), Text(";")), KeysOrder("order")),
+				TemplateInjection("widget", "/item")))
+		univ, r = limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		evaluated = 0
+		lazy := func(v interface{}) LazyParam {
+			return func(context.Context) (interface{}, error) {
+				evaluated++
+				return v, nil
+			}
+		}
+		params = map[string]interface{}{
+			"stats": map[string]interface{}{"a": 1, "b": 2},
+			"order": lazy([]string{"b", "a"}),
+			"widget": map[string]interface{}{
+				"name":   lazy("/item"),
+				"params": lazy(map[string]interface{}{"title": "c"}),
+			},
+		}
+		Expect(univ.Validate("/dashboard", params).HasErrors()).To(BeFalse())
+		Expect(evaluated).To(Equal(0))
+		sb.Reset()
+		_, err = univ.RenderContext(context.WithValue(context.Background(), ctxKey{}, "en"), &sb, "/dashboard", params)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sb.String()).To(Equal("b=2;a=1;<li>cen</li>"))
+		Expect(evaluated).To(Equal(3))
+	})
+	It("renders the same universe concurrently", func() {
+		limbo := New(report.New) // dumb timer of the test reports is not goroutine-safe
+		limbo.Template(
+			"/list",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("ul", Attributes(), Content(
+					Repeat("items", TemplatePlacementWithChildren("/item", Auto(), Content(TextInj("title"))))))))
+		limbo.Template(
+			"/item",
+			WithStylesheet("main"),
+			WithContent(Tag("li", Attributes(If("$first", Attributes(Attr("class", "first")), nil)), Content(Children()))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		var wg sync.WaitGroup
+		results := make([]string, 64)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer GinkgoRecover()
+				items := []map[string]interface{}{}
+				for j := 0; j <= i%4; j++ {
+					items = append(items, map[string]interface{}{"title": fmt.Sprintf("%d.%d", i, j)})
+				}
+				rendered, r := univ.Render("/list", map[string]interface{}{"items": items})
+				Expect(r.HasErrors()).To(BeFalse())
+				results[i] = rendered
+			}(i)
+		}
+		wg.Wait()
+		for i, rendered := range results {
+			expected := "<ul><li class=\"first\">" + fmt.Sprintf("%d.0", i) + "</li>"
+			for j := 1; j <= i%4; j++ {
+				expected += fmt.Sprintf("<li>%d.%d</li>", i, j)
+			}
+			Expect(rendered).To(Equal(expected + "</ul>"))
+		}
+	})
 })
+
+func newLimbo() *Limbo {
+	now, err := time.Parse(time.RFC3339Nano, "2022-05-02T10:11:12.000000000Z")
+	Expect(err).NotTo(HaveOccurred())
+	return New(report.ReportCreator(report.DumbTimer(now)))
+}
+
+type color string
+
+func (c color) String() string {
+	return "<" + string(c) + ">"
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
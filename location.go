@@ -0,0 +1,60 @@
+package gt
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// location of the rule for the error reports: the Go source position, where the rule is constructed,
+// and the path of the tags within the compiled fragments, for example: "html > body > a[href]".
+// The path is relative to the frame of the fragments (template, repeated item, condition branch, children),
+// the full path is composed from the frames on rendering.
+type location struct {
+	source string
+	path   string
+}
+
+const locationSeparator = " > "
+
+// returns location of the rule, constructed by the caller of the rule constructor.
+func here() location {
+	_, file, line, ok := runtime.Caller(2)
+	if !ok {
+		return location{}
+	}
+	return location{
+		source: fmt.Sprintf("%s:%d", file, line),
+	}
+}
+
+// returns the location with the path of the tags, attr is the attribute name for the attribute rules.
+func (at location) within(tags []string, attr string) location {
+	at.path = strings.Join(tags, locationSeparator)
+	if len(attr) > 0 {
+		at.path += "[" + attr + "]"
+	}
+	return at
+}
+
+// returns human-readable location, prefix is the path of the frames, which contain the rule.
+func (at location) describe(prefix ...string) string {
+	var sb strings.Builder
+	write := func(p string) {
+		if len(p) == 0 {
+			return
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(locationSeparator)
+		}
+		sb.WriteString(p)
+	}
+	for _, p := range prefix { // prefix is not appended to, it could share the backing array with the compilation path
+		write(p)
+	}
+	write(at.path)
+	if len(at.source) > 0 {
+		fmt.Fprintf(&sb, " (%s)", at.source)
+	}
+	return sb.String()
+}
@@ -0,0 +1,334 @@
+package gt
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// scope is a params object with fallback values, which are used when the key is not provided by params,
+// for example: static props of the template placement and template props defaults.
+// Repeated items scope also provides loop metadata by pseudo-keys, which are looked up first.
+// Loop metadata is computed on lookup, so the repeated items don't allocate it, when the rules don't use it.
+type scope struct {
+	params    interface{}
+	fallbacks []map[string]interface{}
+	loop      bool        // scope of the repeated item
+	item      interface{} // repeated item or the value of the map entry
+	key       string      // key of the map entry
+	entry     bool        // the item is the map entry
+	index     int
+	count     int
+}
+
+// LazyParam is the param value, which is evaluated on rendering, when the rule uses it,
+// for example, to fetch the data only for the rendered branch. It gets the context of *Universe.RenderContext().
+// Lazy param is evaluated once for the params of the rendered template or repeated item, nil value is considered as not provided.
+type LazyParam func(ctx context.Context) (interface{}, error)
+
+// entry of the map, repeated by RepeatMap().
+type mapEntry struct {
+	key   string
+	value interface{}
+}
+
+// prefix of the pseudo-keys, provided by the rules, but not by the params.
+const pseudoKeyPrefix = "$"
+
+// params could be provided as map[string]interface{} (or any other map with string keys),
+// as structs (or pointers to structs) with `gt:"key"` field tags or as slices of them for repeatable rules.
+// Untagged exported struct fields are available by their names, `gt:"-"` hides the field.
+type paramsPlan struct {
+	fields map[string][]int // params key -> struct field index (path through embedded structs)
+}
+
+const paramsTag = "gt"
+
+var paramsPlans sync.Map // reflect.Type -> *paramsPlan
+
+// returns cached reflection plan for the given struct type.
+func planFor(t reflect.Type) *paramsPlan {
+	if p, ok := paramsPlans.Load(t); ok {
+		return p.(*paramsPlan)
+	}
+	p := &paramsPlan{
+		fields: map[string][]int{},
+	}
+	collectFields(p, t, nil)
+	actual, _ := paramsPlans.LoadOrStore(t, p)
+	return actual.(*paramsPlan)
+}
+func collectFields(p *paramsPlan, t reflect.Type, index []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+		key, tagged := f.Tag.Lookup(paramsTag)
+		if key == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(p, ft, fieldIndex)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if !tagged || len(key) == 0 {
+			key = f.Name
+		}
+		if _, exists := p.fields[key]; exists && len(p.fields[key]) <= len(fieldIndex) {
+			continue // shallower fields shadow the embedded ones
+		}
+		p.fields[key] = fieldIndex
+	}
+}
+
+// returns params with fallback values, fallbacks are looked up in the given order.
+// When params are the scope with fallbacks (Auto() placement), its fallbacks are looked up after the given ones,
+// so the props of the placement and of the placed template take precedence over the props of the caller.
+func withFallbacks(params interface{}, fallbacks ...map[string]interface{}) interface{} {
+	n := 0
+	for _, f := range fallbacks {
+		if len(f) > 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		return params
+	}
+	s := &scope{
+		params: params,
+	}
+	var inherited []map[string]interface{}
+	if p, ok := params.(*scope); ok {
+		*s = *p
+		inherited = p.fallbacks
+	}
+	s.fallbacks = make([]map[string]interface{}, 0, n+len(inherited))
+	for _, f := range fallbacks {
+		if len(f) > 0 {
+			s.fallbacks = append(s.fallbacks, f)
+		}
+	}
+	s.fallbacks = append(s.fallbacks, inherited...)
+	return s
+}
+
+// returns params of the repeated item with the loop metadata, the item itself is available by the "$item" key,
+// for the map entry the key and the value are available by "$key" and "$value" keys.
+func itemScope(item interface{}, i, n int) *scope {
+	s := &scope{
+		loop:  true,
+		item:  item,
+		index: i,
+		count: n,
+	}
+	if entry, ok := item.(mapEntry); ok {
+		s.item, s.key, s.entry = entry.value, entry.key, true
+	}
+	if isParams(s.item) {
+		s.params = s.item
+	}
+	return s
+}
+
+// returns loop metadata of the repeated item scope by the pseudo-key.
+func (s *scope) loopParam(key string) (interface{}, bool) {
+	switch key {
+	case "$item":
+		return s.item, true
+	case "$index":
+		return s.index, true
+	case "$number":
+		return s.index + 1, true
+	case "$first":
+		return s.index == 0, true
+	case "$last":
+		return s.index == s.count-1, true
+	case "$odd":
+		return s.index%2 == 1, true
+	case "$even":
+		return s.index%2 == 0, true
+	case "$key":
+		return s.key, s.entry
+	case "$value":
+		return s.item, s.entry
+	}
+	return nil, false
+}
+
+// returns params value by the key.
+func lookupParam(params interface{}, key string) (interface{}, bool) {
+	switch p := params.(type) {
+	case nil:
+		return nil, false
+	case map[string]interface{}:
+		v, ok := p[key]
+		return v, ok
+	case *scope:
+		if p.loop && strings.HasPrefix(key, pseudoKeyPrefix) {
+			if v, ok := p.loopParam(key); ok {
+				return v, true
+			}
+		}
+		if v, ok := lookupParam(p.params, key); ok {
+			return v, true
+		}
+		for _, f := range p.fallbacks {
+			if v, ok := f[key]; ok {
+				return v, true
+			}
+		}
+		return nil, false
+	}
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		mv := v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+		if !mv.IsValid() {
+			return nil, false
+		}
+		return mv.Interface(), true
+	case reflect.Struct:
+		index, ok := planFor(v.Type()).fields[key]
+		if !ok {
+			return nil, false
+		}
+		fv, err := v.FieldByIndexErr(index)
+		if err != nil { // nil embedded pointer
+			return nil, false
+		}
+		return fv.Interface(), true
+	}
+	return nil, false
+}
+
+// checks whether the value is nil or nil pointer: such params of placements, injections and repeatables are not provided.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// returns the boolean value of the bool or the *bool param, nil pointer is false.
+func boolValue(v interface{}) (bool, bool) {
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case *bool:
+		return t != nil && *t, true
+	}
+	return false, isNil(v)
+}
+
+// checks whether the value could be used as params (map with string keys or struct).
+func isParams(params interface{}) bool {
+	switch params.(type) {
+	case map[string]interface{}, *scope:
+		return true
+	}
+	v := reflect.ValueOf(params)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		return v.Type().Key().Kind() == reflect.String
+	case reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// returns list of params for repeatable rule: any slice or array.
+// Items could be params objects (maps or structs) or scalars, which are available by the "$item" key.
+func listParams(params interface{}) ([]interface{}, bool) {
+	switch p := params.(type) {
+	case []interface{}:
+		return p, true
+	case []map[string]interface{}:
+		items := make([]interface{}, len(p))
+		for i, item := range p {
+			items[i] = item
+		}
+		return items, true
+	case []string:
+		items := make([]interface{}, len(p))
+		for i, item := range p {
+			items[i] = item
+		}
+		return items, true
+	}
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, true
+}
+
+// returns entries of the map with string keys for map repeatable rule, sorted by keys.
+func mapParams(params interface{}) ([]interface{}, bool) {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return nil, false
+	}
+	entries := make([]interface{}, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries = append(entries, mapEntry{
+			key:   iter.Key().String(),
+			value: iter.Value().Interface(),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].(mapEntry).key < entries[j].(mapEntry).key
+	})
+	return entries, true
+}
+
+// checks whether the param value is true for conditions:
+// true boolean, non-empty string, slice or map, non-nil value of other types.
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return len(t) > 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Pointer, reflect.Interface:
+		return !rv.IsNil()
+	}
+	return true
+}
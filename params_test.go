@@ -0,0 +1,70 @@
+package gt_test
+
+import (
+	. "github.com/Contra-Culture/gt"
+	"github.com/Contra-Culture/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("params", func() {
+	It("renders templates with struct params", func() {
+		type (
+			comment struct {
+				Author string `gt:"comment-author"`
+			}
+			article struct {
+				Title    string    `gt:"article-title"`
+				Link     string    `gt:"article-link"`
+				Comments []comment `gt:"comments"`
+				hidden   string
+			}
+			author struct {
+				Name string
+			}
+			page struct {
+				Articles []*article `gt:"articles"`
+				Author   author     `gt:"author"`
+			}
+		)
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Repeat("articles", TemplatePlacement("/article", Auto())),
+				TemplatePlacement("/author", "author")))
+		limbo.Template(
+			"/article",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a",
+					Attributes(AttrInjection("href", "article-link")),
+					Content(TextInj("article-title"))),
+				Repeat("comments", TemplatePlacement("/comment", Auto()))))
+		limbo.Template(
+			"/comment",
+			WithStylesheet("main"),
+			WithContent(Tag("i", Attributes(), Content(TextInj("comment-author")))))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(Tag("b", Attributes(), Content(TextInj("Name")))))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		rendered, r := univ.Render("/page", page{
+			Articles: []*article{
+				{Title: "First", Link: "/1", Comments: []comment{{Author: "Sam"}, {Author: "John"}}},
+				{Title: "Second", Link: "/2", hidden: "hidden"},
+			},
+			Author: author{Name: "Jane"},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		Expect(rendered).To(Equal("<a href=\"/1\">First</a><i>Sam</i><i>John</i><a href=\"/2\">Second</a><b>Jane</b>"))
+		_, r = univ.Render("/page", struct {
+			Articles string `gt:"articles"`
+		}{Articles: "first"})
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(ContainSubstring("repeatable params \"articles\" should be a slice, got: string"))
+	})
+})
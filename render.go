@@ -0,0 +1,658 @@
+package gt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/Contra-Culture/report"
+)
+
+// Rendering executes compiled fragments with the explicit stack of frames: placements, conditions, repeatables and children
+// push (call) the frame with their fragments, theEnd fragment pops (returns from) it.
+// Compiled fragments are never modified on rendering, so the universe could be rendered concurrently.
+type (
+	frame struct {
+		fragments []interface{}
+		cursor    int
+		params    interface{}
+		children  *childrenFrame
+		template  bool                   // frame of the placed or injected template, counts the nesting depth
+		items     []interface{}          // repeated items, when the frame renders repeatable rule
+		item      int                    // index of the current repeated item
+		label     string                 // frame description for the error locations: template name, repeatable or condition branch
+		at        string                 // path of the rule, which called the frame, within the parent frame
+		inherited bool                   // frame of the condition branch, which renders the params of the parent frame
+		lazy      map[string]interface{} // evaluated lazy params of the frame params
+	}
+	childrenFrame struct { // compiled children content with the params of the template, which placed it
+		fragments []interface{}
+		params    interface{}
+		parent    *childrenFrame // children of the template, which placed the children content
+	}
+	renderer struct {
+		ctx         context.Context // is passed to the lazy params, context formatters and filters
+		u           *Universe
+		r           report.Node
+		w           *bufio.Writer
+		frames      []frame
+		depth       int    // nesting level of the placed and injected templates
+		err         error  // rendering error, rendering stops on the first one
+		lenient     bool   // missing params are reported as warnings, rendering continues
+		placeholder string // content of the missing injections in the lenient mode
+	}
+	// RenderOption configures the rendering mode, the default mode is Strict().
+	RenderOption func(*renderer)
+)
+
+const renderBufferSize = 4096
+
+// renderers are reused by the renderings to avoid frames stack and write buffer allocations.
+var renderers = sync.Pool{
+	New: func() interface{} {
+		return &renderer{
+			w:      bufio.NewWriterSize(nil, renderBufferSize),
+			frames: make([]frame, 0, 32),
+		}
+	},
+}
+
+// Strict() mode stops rendering on the first missing param and reports it as an error.
+func Strict() RenderOption {
+	return func(rn *renderer) {
+		rn.lenient = false
+		rn.placeholder = ""
+	}
+}
+
+// Lenient() mode reports missing params as warnings and continues rendering:
+// missing injections are rendered empty, the rules with missing params (placements, injections, repeatables, switches) are skipped.
+// Wrong types of the params are still reported as errors.
+func Lenient() RenderOption {
+	return LenientWith("")
+}
+
+// LenientWith() is Lenient() mode, where the missing injections are replaced with the placeholder.
+// Placeholder is escaped like the injected values are.
+func LenientWith(placeholder string) RenderOption {
+	return func(rn *renderer) {
+		rn.lenient = true
+		rn.placeholder = placeholder
+	}
+}
+
+// *Universe.Render() renders template into a string.
+// Params could be a map[string]interface{} or a struct with `gt:"key"` field tags.
+func (u *Universe) Render(n string, params interface{}, opts ...RenderOption) (string, report.Node) {
+	var sb strings.Builder
+	r := u.RenderTo(&sb, n, params, opts...)
+	if r.HasErrors() {
+		return "", r
+	}
+	return sb.String(), r
+}
+
+// *Universe.RenderTo() renders template directly into the given writer, fragment by fragment,
+// so the page is never accumulated in memory. The output is buffered and flushed when the buffer is full
+// and at the end of rendering. Write errors are reported into the returned report node.
+func (u *Universe) RenderTo(w io.Writer, n string, params interface{}, opts ...RenderOption) report.Node {
+	r, _ := u.render(context.Background(), w, n, params, opts)
+	return r
+}
+
+// *Universe.RenderE() renders template into a string like Render() does, but returns the rendering error
+// instead of the report node: *MissingParamError, *ParamTypeError, *UnknownTemplateError or other error of the rule.
+// In the Lenient() mode missing params are not errors.
+func (u *Universe) RenderE(n string, params interface{}, opts ...RenderOption) (string, error) {
+	var sb strings.Builder
+	_, err := u.render(context.Background(), &sb, n, params, opts)
+	if err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// *Universe.RenderContext() renders template into the writer like RenderTo() does, but aborts the rendering,
+// when the context is canceled or its deadline is exceeded: the context is checked before each placed
+// or injected template and each repeated item, the returned error wraps the context error then.
+// The context is passed to the lazy params, context formatters and filters.
+func (u *Universe) RenderContext(ctx context.Context, w io.Writer, n string, params interface{}, opts ...RenderOption) (report.Node, error) {
+	return u.render(ctx, w, n, params, opts)
+}
+func (u *Universe) render(ctx context.Context, w io.Writer, n string, params interface{}, opts []RenderOption) (report.Node, error) {
+	r := u.reportCreator("rendering template \"%s\"", n)
+	t, ok := u.templates[n]
+	if !ok {
+		err := &UnknownTemplateError{Name: n}
+		r.Error("%s", err)
+		return r, err
+	}
+	rn := renderers.Get().(*renderer)
+	rn.ctx = ctx
+	rn.u = u
+	rn.r = r
+	rn.w.Reset(w)
+	for _, opt := range opts {
+		opt(rn)
+	}
+	rn.push(frame{fragments: t.fragments, params: withFallbacks(params, t.props), template: true, label: t.name})
+	if !rn.canceled(location{}) {
+		rn.run()
+	}
+	err := rn.err
+	flushErr := rn.w.Flush()
+	if flushErr != nil {
+		r.Error("can't write rendered template: %s", flushErr)
+		if err == nil {
+			err = fmt.Errorf("can't write rendered template: %w", flushErr)
+		}
+	}
+	rn.release()
+	return r, err
+}
+
+// resets the renderer state, so it doesn't retain params and writer, and returns it to the pool.
+func (rn *renderer) release() {
+	for i := range rn.frames {
+		rn.frames[i] = frame{}
+	}
+	rn.frames = rn.frames[:0]
+	rn.depth = 0
+	rn.err = nil
+	rn.lenient = false
+	rn.placeholder = ""
+	rn.ctx = nil
+	rn.u = nil
+	rn.r = nil
+	rn.w.Reset(nil)
+	renderers.Put(rn)
+}
+
+// calls the frame.
+func (rn *renderer) push(f frame) {
+	if f.template {
+		rn.depth++
+	}
+	rn.frames = append(rn.frames, f)
+}
+
+// returns from the current frame or starts its next repeated item.
+func (rn *renderer) pop() {
+	top := &rn.frames[len(rn.frames)-1]
+	if top.item+1 < len(top.items) {
+		top.item++
+		top.cursor = 0
+		top.params = itemScope(top.items[top.item], top.item, len(top.items))
+		top.lazy = nil
+		return
+	}
+	if top.template {
+		rn.depth--
+	}
+	*top = frame{}
+	rn.frames = rn.frames[:len(rn.frames)-1]
+}
+
+// returns params value by the key, lazy param is evaluated with the rendering context once for the frame params.
+func (rn *renderer) param(params interface{}, key string) (interface{}, bool, error) {
+	return rn.paramAt(params, key, key)
+}
+
+// returns params value by the key, path is the key path within the frame params, lazy param is memoized by it.
+func (rn *renderer) paramAt(params interface{}, key, path string) (interface{}, bool, error) {
+	v, exists := lookupParam(params, key)
+	lazy, ok := v.(LazyParam)
+	if !ok {
+		return v, exists, nil
+	}
+	i := len(rn.frames) - 1
+	for rn.frames[i].inherited {
+		i--
+	}
+	owner := &rn.frames[i]
+	if v, evaluated := owner.lazy[path]; evaluated {
+		return v, v != nil, nil
+	}
+	v, err := lazy(rn.ctx)
+	if err != nil {
+		return nil, true, fmt.Errorf("lazy param failed: %w", err)
+	}
+	if owner.lazy == nil {
+		owner.lazy = map[string]interface{}{}
+	}
+	owner.lazy[path] = v
+	return v, v != nil, nil
+}
+
+// returns injected value by the key, passed through the filters.
+func (rn *renderer) filteredParam(params interface{}, key string, filters []filter) (interface{}, bool, error) {
+	v, exists, err := rn.param(params, key)
+	if err != nil {
+		return nil, exists, err
+	}
+	return filterValue(rn.ctx, v, exists, filters)
+}
+
+// returns the location of the rule: the path of the frames and tags and the Go source position of the rule.
+func (rn *renderer) locate(at location) string {
+	prefix := make([]string, 0, 2*len(rn.frames))
+	for _, f := range rn.frames {
+		label := f.label
+		if f.items != nil {
+			label = fmt.Sprintf("%s[%d]", label, f.item)
+		}
+		prefix = append(prefix, f.at, label)
+	}
+	return at.describe(prefix...)
+}
+
+// reports the rendering error, rendering stops on it.
+func (rn *renderer) fail(err error) {
+	rn.err = err
+	rn.r.Error("%s", err)
+}
+
+// reports the missing param, returns true when the rendering continues in the lenient mode.
+func (rn *renderer) missing(err *MissingParamError) bool {
+	if !rn.lenient {
+		rn.fail(err)
+		return false
+	}
+	rn.r.Warn("%s", err)
+	return true
+}
+
+// checks the context on the placement and repeatable boundaries, reports the context error.
+func (rn *renderer) canceled(at location) bool {
+	err := rn.ctx.Err()
+	if err == nil {
+		return false
+	}
+	rn.fail(fmt.Errorf("rendering aborted at %s: %w", rn.locate(at), err))
+	return true
+}
+
+// reports the rendering error of the rule, which has no specific error type.
+func (rn *renderer) errorAt(at location, format string, args ...interface{}) {
+	rn.fail(fmt.Errorf("%s at %s", fmt.Sprintf(format, args...), rn.locate(at)))
+}
+
+// calls the template frame, when the max nesting depth is not exceeded.
+func (rn *renderer) enter(t *Template, params interface{}, children *childrenFrame, at location) bool {
+	if rn.depth >= rn.u.maxDepth {
+		return false
+	}
+	rn.push(frame{fragments: t.fragments, params: params, children: children, template: true, label: t.name, at: at.path})
+	return true
+}
+
+// calls the placed template frame, params are the params of the current frame.
+func (rn *renderer) place(f templatePlacement, params interface{}, children *childrenFrame) bool {
+	tPl, exists := rn.u.templates[f.name]
+	if !exists {
+		rn.fail(&UnknownTemplateError{Name: f.name, Location: rn.locate(f.at)})
+		return false
+	}
+	plParams := params
+	if f.key != auto { // auto placement is used within repeatable rule
+		var exists bool
+		var err error
+		plParams, exists, err = rn.param(params, f.key)
+		if err != nil {
+			rn.errorAt(f.at, "template placement params \"%s\": %s", f.key, err)
+			return false
+		}
+		exists = exists && !isNil(plParams)
+		if !exists && len(f.props) == 0 && len(tPl.props) == 0 {
+			return rn.missing(&MissingParamError{Rule: "template placement params", Key: f.key, Location: rn.locate(f.at)})
+		}
+		if exists && !isParams(plParams) {
+			rn.fail(&ParamTypeError{Rule: "template placement params", Key: f.key, Expected: "a map or a struct", Value: plParams, Location: rn.locate(f.at)})
+			return false
+		}
+	}
+	if f.compiledChildren != nil {
+		children = &childrenFrame{
+			fragments: f.compiledChildren,
+			params:    params,
+			parent:    children,
+		}
+	} else {
+		children = nil
+	}
+	if rn.canceled(f.at) {
+		return false
+	}
+	if !rn.enter(tPl, withFallbacks(plParams, f.props, tPl.props), children, f.at) {
+		rn.errorAt(f.at, "template \"%s\" placement exceeds max nesting depth %d", f.name, rn.u.maxDepth)
+		return false
+	}
+	return true
+}
+
+// renders fragments of the frames stack into the buffered writer, stops on the first error.
+// Write errors are sticky for *bufio.Writer, so they are reported once by the caller on flush.
+// Formatters, filters, lazy and fmt.Stringer params are the user code, their panics are reported as rendering errors.
+func (rn *renderer) run() {
+	defer func() {
+		if p := recover(); p != nil {
+			rn.errorAt(location{}, "rendering panicked: %v", p)
+		}
+	}()
+	w := rn.w
+	r := rn.r
+	for len(rn.frames) > 0 {
+		top := &rn.frames[len(rn.frames)-1] // is not valid after push
+		rawFragment := top.fragments[top.cursor]
+		top.cursor++
+		params := top.params
+		children := top.children
+		switch f := rawFragment.(type) {
+		case theEnd:
+			rn.pop()
+			if top.items != nil && rn.canceled(location{}) { // popped frame is zeroed, so the top frame started the next repeated item
+				return
+			}
+		case string:
+			_, err := w.WriteString(f)
+			if err != nil {
+				return
+			}
+		case templatePlacement:
+			if !rn.place(f, params, children) {
+				return
+			}
+		case childrenPlacement:
+			if children == nil { // template is placed without children
+				continue
+			}
+			rn.push(frame{fragments: children.fragments, params: children.params, children: children.parent, label: "Children()", at: f.at.path})
+		case templateInjection:
+			data, exists, err := rn.param(params, f.key)
+			if err != nil {
+				rn.errorAt(f.at, "template injection \"%s\": %s", f.key, err)
+				return
+			}
+			exists = exists && !isNil(data)
+			if !exists {
+				if !rn.missing(&MissingParamError{Rule: "template injection", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				continue
+			}
+			if !isParams(data) {
+				rn.fail(&ParamTypeError{Rule: "template injection", Key: f.key, Expected: "a map or a struct", Value: data, Location: rn.locate(f.at)})
+				return
+			}
+			_tn, ok, err := rn.paramAt(data, "name", f.key+".name")
+			if err != nil {
+				rn.errorAt(f.at, "template name for injection \"%s\": %s", f.key, err)
+				return
+			}
+			if !ok {
+				if !rn.missing(&MissingParamError{Rule: "template name for injection", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				continue
+			}
+			tn, ok := _tn.(string)
+			if !ok {
+				rn.fail(&ParamTypeError{Rule: "template name for injection", Key: f.key, Expected: "a string", Value: _tn, Location: rn.locate(f.at)})
+				return
+			}
+			injParams, ok, err := rn.paramAt(data, "params", f.key+".params")
+			if err != nil {
+				rn.errorAt(f.at, "template params for injection \"%s\": %s", f.key, err)
+				return
+			}
+			if !ok {
+				if !rn.missing(&MissingParamError{Rule: "template params for injection", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				continue
+			}
+			if !isParams(injParams) {
+				rn.fail(&ParamTypeError{Rule: "template params for injection", Key: f.key, Expected: "a map or a struct", Value: injParams, Location: rn.locate(f.at)})
+				return
+			}
+			if !allowedTemplate(f.allowed, tn) {
+				rn.errorAt(f.at, "template \"%s\" is not allowed for injection \"%s\"", tn, f.key)
+				return
+			}
+			injT, ok := rn.u.templates[tn]
+			if !ok {
+				rn.fail(&UnknownTemplateError{Name: tn, Location: rn.locate(f.at)})
+				return
+			}
+			if rn.canceled(f.at) {
+				return
+			}
+			if !rn.enter(injT, withFallbacks(injParams, injT.props), nil, f.at) {
+				rn.errorAt(f.at, "template \"%s\" injection \"%s\" exceeds max nesting depth %d", tn, f.key, rn.u.maxDepth)
+				return
+			}
+		case attributeInjection:
+			_v, exists, err := rn.filteredParam(params, f.key, f.filters)
+			if err != nil {
+				rn.errorAt(f.at, "attribute value injection \"%s\": %s", f.key, err)
+				return
+			}
+			if !exists {
+				if !rn.missing(&MissingParamError{Rule: "attribute value injection", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				_v = rn.placeholder
+			}
+			v, err := formatValue(_v)
+			if err != nil {
+				rn.errorAt(f.at, "attribute value injection \"%s\" can't be formatted: %s", f.key, err)
+				return
+			}
+			if !f.unsafe {
+				var ok bool
+				v, ok = escapeAttributeValue(f.name, v)
+				if !ok {
+					r.Warn("unsafe URL in attribute \"%s\" value injection \"%s\" replaced", f.name, f.key)
+				}
+			}
+			_, err = w.WriteString(v)
+			if err != nil {
+				return
+			}
+		case booleanAttribute:
+			_v, exists, err := rn.param(params, f.key)
+			if err != nil {
+				rn.errorAt(f.at, "boolean attribute \"%s\" param \"%s\": %s", f.name, f.key, err)
+				return
+			}
+			if !exists {
+				continue
+			}
+			v, ok := boolValue(_v)
+			if !ok {
+				rule := fmt.Sprintf("boolean attribute \"%s\" param", f.name)
+				rn.fail(&ParamTypeError{Rule: rule, Key: f.key, Expected: "a boolean", Value: _v, Location: rn.locate(f.at)})
+				return
+			}
+			if !v {
+				continue
+			}
+			w.WriteByte(' ')
+			_, err = w.WriteString(f.name)
+			if err != nil {
+				return
+			}
+		case optionalAttributeInjection:
+			_v, exists, err := rn.filteredParam(params, f.key, f.filters)
+			if err != nil {
+				rn.errorAt(f.at, "attribute value injection \"%s\": %s", f.key, err)
+				return
+			}
+			if !exists || isNil(_v) {
+				continue
+			}
+			v, err := formatValue(_v)
+			if err != nil {
+				rn.errorAt(f.at, "attribute value injection \"%s\" can't be formatted: %s", f.key, err)
+				return
+			}
+			if len(v) == 0 {
+				continue
+			}
+			v, ok := escapeAttributeValue(f.name, v)
+			if !ok {
+				r.Warn("unsafe URL in attribute \"%s\" value injection \"%s\" replaced", f.name, f.key)
+			}
+			_, err = fmt.Fprintf(w, " %s=\"%s\"", f.name, v)
+			if err != nil {
+				return
+			}
+		case textInjection:
+			_v, exists, err := rn.filteredParam(params, f.key, f.filters)
+			if err != nil {
+				rn.errorAt(f.at, "text injection \"%s\": %s", f.key, err)
+				return
+			}
+			if !exists {
+				if !rn.missing(&MissingParamError{Rule: "text injection", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				_v = rn.placeholder
+			}
+			var v string
+			if f.formatter != nil && exists {
+				v, err = f.formatter(rn.ctx, _v)
+			} else {
+				v, err = formatValue(_v)
+			}
+			if err != nil {
+				rn.errorAt(f.at, "text injection \"%s\" can't be formatted: %s", f.key, err)
+				return
+			}
+			_, safe := _v.(SafeHTML)
+			if !f.unsafe && !(safe && f.formatter == nil && f.context == textContext) {
+				v = escape(f.context, v)
+			}
+			_, err = w.WriteString(v)
+			if err != nil {
+				return
+			}
+		case repeatable:
+			rawRepParams, ok, err := rn.param(params, f.key)
+			if err != nil {
+				rn.errorAt(f.at, "repeatable params \"%s\": %s", f.key, err)
+				return
+			}
+			ok = ok && !isNil(rawRepParams)
+			if !ok && !f.hasElse {
+				if !rn.missing(&MissingParamError{Rule: "repeatable params", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				continue
+			}
+			var repParams []interface{}
+			switch {
+			case ok && f.order != nil:
+				repParams, ok = mapParams(rawRepParams)
+				if !ok {
+					rn.fail(&ParamTypeError{Rule: "repeatable params", Key: f.key, Expected: "a map with string keys", Value: rawRepParams, Location: rn.locate(f.at)})
+					return
+				}
+				err := f.order.sort(repParams, func(key string) (interface{}, bool, error) {
+					return rn.param(params, key)
+				})
+				var missing *MissingParamError
+				if errors.As(err, &missing) {
+					missing.Location = rn.locate(f.at)
+					if !rn.missing(missing) {
+						return
+					}
+					continue
+				}
+				if err != nil {
+					rn.errorAt(f.at, "repeatable params \"%s\": %s", f.key, err)
+					return
+				}
+			case ok:
+				repParams, ok = listParams(rawRepParams)
+				if !ok {
+					rn.fail(&ParamTypeError{Rule: "repeatable params", Key: f.key, Expected: "a slice", Value: rawRepParams, Location: rn.locate(f.at)})
+					return
+				}
+			}
+			if len(repParams) == 0 {
+				if f.hasElse {
+					rn.push(frame{fragments: f.otherwiseFragments, params: params, children: children, label: f.otherwiseLabel, at: f.at.path, inherited: true})
+				}
+				continue
+			}
+			if rn.canceled(f.at) {
+				return
+			}
+			rn.push(frame{
+				fragments: f.fragments,
+				params:    itemScope(repParams[0], 0, len(repParams)),
+				children:  children,
+				items:     repParams,
+				label:     f.label,
+				at:        f.at.path,
+			})
+		case conditional:
+			branch, label := f.otherwise, f.otherwiseLabel
+			v, exists, err := rn.param(params, f.key)
+			if err != nil {
+				rn.errorAt(f.at, "condition \"%s\": %s", f.key, err)
+				return
+			}
+			if exists && truthy(v) {
+				branch, label = f.then, f.thenLabel
+			}
+			rn.push(frame{fragments: branch, params: params, children: children, label: label, at: f.at.path, inherited: true})
+		case variant:
+			placement := templatePlacement{name: f.defaultTemplateName, key: auto, at: f.at}
+			plParams := interface{}(map[string]interface{}{})
+			for _, k := range f.keys {
+				v, ok, err := rn.param(params, k)
+				if err != nil {
+					rn.errorAt(f.at, "variant \"%s\": %s", k, err)
+					return
+				}
+				if ok && !isNil(v) {
+					placement = templatePlacement{name: f.templates[k], key: k, at: f.at}
+					plParams = params
+					break
+				}
+			}
+			if !rn.place(placement, plParams, children) {
+				return
+			}
+		case switching:
+			v, exists, err := rn.param(params, f.key)
+			if err != nil {
+				rn.errorAt(f.at, "switch \"%s\": %s", f.key, err)
+				return
+			}
+			if !exists && len(f.defaultTemplateName) == 0 {
+				if !rn.missing(&MissingParamError{Rule: "switch discriminator", Key: f.key, Location: rn.locate(f.at)}) {
+					return
+				}
+				continue
+			}
+			n, err := switchCase(f.templates, f.defaultTemplateName, v, exists)
+			if err != nil {
+				rn.errorAt(f.at, "switch \"%s\": %s", f.key, err)
+				return
+			}
+			if !rn.place(templatePlacement{name: n, key: auto, at: f.at}, params, children) {
+				return
+			}
+		default:
+			rn.fail(fmt.Errorf("wrong type of fragment %#v", f))
+			return
+		}
+	}
+}
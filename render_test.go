@@ -0,0 +1,46 @@
+package gt_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	. "github.com/Contra-Culture/gt"
+	"github.com/Contra-Culture/report"
+)
+
+// BenchmarkRenderRepeat renders the list of 100 items, each item is rendered by the placed template.
+func BenchmarkRenderRepeat(b *testing.B) {
+	limbo := New(report.New)
+	limbo.Template(
+		"/list",
+		WithStylesheet("main"),
+		WithContent(
+			Tag("ul", Attributes(), Content(
+				Repeat("items", TemplatePlacement("/item", Auto()))))))
+	limbo.Template(
+		"/item",
+		WithStylesheet("main"),
+		WithContent(Tag("li", Attributes(AttrInjection("id", "id")), Content(TextInj("title")))))
+	univ, r := limbo.Universe()
+	if r.HasErrors() {
+		b.Fatal(report.ToString(r))
+	}
+	items := make([]map[string]interface{}, 100)
+	for i := range items {
+		items[i] = map[string]interface{}{"id": fmt.Sprintf("item-%d", i), "title": fmt.Sprintf("Item %d", i)}
+	}
+	params := map[string]interface{}{"items": items}
+	b.Run("Render", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			univ.Render("/list", params)
+		}
+	})
+	b.Run("RenderTo", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			univ.RenderTo(io.Discard, "/list", params)
+		}
+	})
+}
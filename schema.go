@@ -0,0 +1,376 @@
+package gt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Contra-Culture/report"
+)
+
+type (
+	ParamKind string
+	// Param describes a single param, the template expects on rendering.
+	Param struct {
+		Key       string             `json:"key"`
+		Kind      ParamKind          `json:"kind"`
+		Schema    *Schema            `json:"schema,omitempty"`    // for nested, list, map and variant params: schema of the placed template (item), for condition: params of the "then" branch
+		Else      *Schema            `json:"else,omitempty"`      // for condition: params of the "else" branch, for list: params of the else rule, for switch: schema of the default template
+		Cases     map[string]*Schema `json:"cases,omitempty"`     // for switch: schemas of the case templates by the discriminator values
+		Allowed   []string           `json:"allowed,omitempty"`   // for injection: names of the templates, which could be injected
+		Optional  bool               `json:"optional,omitempty"`  // true, when the param could be omitted
+		Formatter string             `json:"formatter,omitempty"` // for text: name of the formatter, which accepts the value
+		Filters   []string           `json:"filters,omitempty"`   // for text and attr: names of the filters, applied to the value
+		Default   interface{}        `json:"default,omitempty"`   // value of the template prop or static prop, used when the param is omitted
+	}
+	// Schema describes params, the template expects on rendering.
+	Schema struct {
+		Template  string  `json:"template"`
+		Params    []Param `json:"params"`
+		Recursive bool    `json:"recursive,omitempty"` // true, when the template is already described above, so params are omitted
+	}
+	// param is an unresolved schema entry, collected while the template is compiled.
+	// Placed templates are referenced by names, because they may be not compiled yet.
+	param struct {
+		key         string
+		kind        ParamKind
+		template    string  // placed template name
+		params      []param // item params for list, "then" branch params for condition
+		alternative []param // "else" branch params for condition, else rule params for list
+		optional    bool
+		formatter   string
+		filters     []string
+		props       StaticProps       // static props of the placement for nested and inline
+		cases       map[string]string // case templates names for switch, template is the default one
+		allowed     []string          // names of the templates, which could be injected
+	}
+)
+
+const (
+	TextParam      ParamKind = "text"      // string for text injection
+	AttrParam      ParamKind = "attr"      // string for attribute value injection
+	ListParam      ParamKind = "list"      // slice of params for repeatable
+	MapParam       ParamKind = "map"       // map with string keys for map repeatable
+	NestedParam    ParamKind = "nested"    // params for the placed template
+	VariantParam   ParamKind = "variant"   // optional params for the variant template
+	InjectionParam ParamKind = "injection" // name and params of the template to inject
+	ConditionParam ParamKind = "condition" // optional boolean, string or slice, which selects the condition branch
+	SwitchParam    ParamKind = "switch"    // string discriminator, which selects the switch case template
+	BoolParam      ParamKind = "bool"      // boolean for boolean attribute
+	inlineParam    ParamKind = "inline"    // template placed with Auto() key, its params are merged into the current level
+)
+
+// returns schema entry for the text or attribute value injection, injections with "default" filter are optional.
+func injectionParam(key string, kind ParamKind, chains []FilterChain) param {
+	p := param{
+		key:  key,
+		kind: kind,
+	}
+	if len(chains) == 0 {
+		return p
+	}
+	p.filters = filterNames(chains)
+	for _, name := range p.filters {
+		if name == "default" {
+			p.optional = true
+		}
+	}
+	return p
+}
+
+// *Universe.Schema() returns params schema of the template.
+func (u *Universe) Schema(n string) (*Schema, bool) {
+	t, exists := u.templates[n]
+	if !exists {
+		return nil, false
+	}
+	return u.schema(t, map[string]bool{}), true
+}
+func (u *Universe) schema(t *Template, resolving map[string]bool) *Schema {
+	s := &Schema{
+		Template: t.name,
+	}
+	if resolving[t.name] {
+		s.Recursive = true
+		return s
+	}
+	resolving[t.name] = true
+	defer delete(resolving, t.name)
+	s.Params = u.resolveParams(t.params, resolving, []Param{})
+	applyDefaults(s.Params, t.props)
+	return s
+}
+
+// makes params optional, when their values are provided by props, the first props with the key define the default.
+// Defaults, already defined by the props of the inlined placement, are kept: the caller's props are looked up after them.
+func applyDefaults(params []Param, props ...map[string]interface{}) {
+	for i := range params {
+		if params[i].Default != nil {
+			continue
+		}
+		for _, p := range props {
+			if v, exists := p[params[i].Key]; exists {
+				params[i].Optional = true
+				params[i].Default = v
+				break
+			}
+		}
+	}
+}
+func (u *Universe) resolveParams(params []param, resolving map[string]bool, resolved []Param) []Param {
+	for _, p := range params {
+		if strings.HasPrefix(p.key, pseudoKeyPrefix) && p.kind != ConditionParam {
+			continue // provided by the rules
+		}
+		switch p.kind {
+		case inlineParam:
+			t, exists := u.templates[p.template]
+			if !exists || resolving[t.name] {
+				continue
+			}
+			resolving[t.name] = true
+			inlined := len(resolved)
+			resolved = u.resolveParams(t.params, resolving, resolved)
+			applyDefaults(resolved[inlined:], p.props, t.props)
+			delete(resolving, t.name)
+			continue
+		}
+		rp := Param{
+			Key:       p.key,
+			Kind:      p.kind,
+			Optional:  p.optional || p.kind == ConditionParam,
+			Formatter: p.formatter,
+			Filters:   p.filters,
+			Allowed:   p.allowed,
+		}
+		switch p.kind {
+		case NestedParam, VariantParam:
+			if t, exists := u.templates[p.template]; exists {
+				rp.Schema = u.schema(t, resolving)
+				applyDefaults(rp.Schema.Params, p.props)
+				if len(p.props) > 0 || len(t.props) > 0 {
+					rp.Optional = true
+				}
+			}
+		case ListParam, MapParam:
+			if len(p.params) == 1 && p.params[0].kind == inlineParam {
+				if t, exists := u.templates[p.params[0].template]; exists {
+					rp.Schema = u.schema(t, resolving)
+					break
+				}
+			}
+			rp.Schema = &Schema{
+				Params: u.resolveParams(p.params, resolving, []Param{}),
+			}
+			if p.optional {
+				rp.Else = &Schema{
+					Params: u.resolveParams(p.alternative, resolving, []Param{}),
+				}
+			}
+		case ConditionParam:
+			rp.Schema = &Schema{
+				Params: u.resolveParams(p.params, resolving, []Param{}),
+			}
+			rp.Else = &Schema{
+				Params: u.resolveParams(p.alternative, resolving, []Param{}),
+			}
+		case SwitchParam:
+			rp.Cases = map[string]*Schema{}
+			for v, n := range p.cases {
+				if t, exists := u.templates[n]; exists {
+					rp.Cases[v] = u.schema(t, resolving)
+				}
+			}
+			if t, exists := u.templates[p.template]; exists {
+				rp.Else = u.schema(t, resolving)
+			}
+		}
+		resolved = appendParam(resolved, rp)
+	}
+	return resolved
+}
+
+// appends param to the list, unless the same key is already described with the same kind.
+func appendParam(params []Param, p Param) []Param {
+	if p.Kind == ConditionParam || p.Kind == SwitchParam { // conditions and switches on the same key may have different branches
+		return append(params, p)
+	}
+	for _, existing := range params {
+		if existing.Key == p.Key && existing.Kind == p.Kind {
+			return params
+		}
+	}
+	return append(params, p)
+}
+
+// *Universe.Validate() checks params against the template schema before rendering.
+// All the problems are reported at once, instead of failing on the first one.
+func (u *Universe) Validate(n string, params interface{}) report.Node {
+	r := u.reportCreator("validating params for template \"%s\"", n)
+	t, exists := u.templates[n]
+	if !exists {
+		r.Error("template \"%s\" not found", n)
+		return r
+	}
+	u.validate(r, t.params, withFallbacks(params, t.props), "")
+	return r
+}
+func (u *Universe) validate(r report.Node, schema []param, params interface{}, path string) {
+	for _, p := range u.flattenParams(schema, map[string]bool{}, []param{}) {
+		keyPath := path + p.key
+		v, exists := lookupParam(params, p.key)
+		if _, lazy := v.(LazyParam); lazy {
+			continue // lazy params are evaluated on rendering only
+		}
+		switch p.kind {
+		case NestedParam, VariantParam, ListParam, MapParam, InjectionParam:
+			exists = exists && !isNil(v)
+		case BoolParam, AttrParam:
+			exists = exists && !(p.optional && isNil(v)) // optional attributes are omitted
+		}
+		if p.kind == ConditionParam {
+			if exists && truthy(v) {
+				u.validate(r, p.params, params, path)
+			} else {
+				u.validate(r, p.alternative, params, path)
+			}
+			continue
+		}
+		if p.kind == SwitchParam {
+			n, err := switchCase(p.cases, p.template, v, exists)
+			if err != nil {
+				r.Error("param \"%s\": %s", keyPath, err)
+				continue
+			}
+			if t, exists := u.templates[n]; exists {
+				u.validate(r, t.params, withFallbacks(params, t.props), path)
+			}
+			continue
+		}
+		if !exists && strings.HasPrefix(p.key, pseudoKeyPrefix) {
+			continue // provided by the rules
+		}
+		if p.kind == ListParam && p.optional {
+			if items, ok := listParams(v); !exists || (ok && len(items) == 0) {
+				u.validate(r, p.alternative, params, path)
+				continue
+			}
+		}
+		if !exists {
+			if p.kind == NestedParam {
+				if t, exists := u.templates[p.template]; exists && (len(p.props) > 0 || len(t.props) > 0) {
+					u.validate(r, t.params, withFallbacks(nil, p.props, t.props), keyPath+".")
+					continue
+				}
+			}
+			if !p.optional {
+				r.Error("param \"%s\" not provided", keyPath)
+			}
+			continue
+		}
+		switch p.kind {
+		case TextParam, AttrParam:
+			if len(p.formatter) == 0 && len(p.filters) == 0 && !formattable(v) {
+				r.Error("param \"%s\" should be a string, number, boolean, time.Time, fmt.Stringer or encoding.TextMarshaler, got: %T", keyPath, v)
+			}
+		case BoolParam:
+			if _, ok := boolValue(v); !ok {
+				r.Error("param \"%s\" should be a boolean, got: %T", keyPath, v)
+			}
+		case NestedParam, VariantParam:
+			if !isParams(v) {
+				r.Error("param \"%s\" should be a map or a struct, got: %T", keyPath, v)
+				continue
+			}
+			if t, exists := u.templates[p.template]; exists {
+				u.validate(r, t.params, withFallbacks(v, p.props, t.props), keyPath+".")
+			}
+		case ListParam:
+			items, ok := listParams(v)
+			if !ok {
+				r.Error("param \"%s\" should be a slice, got: %T", keyPath, v)
+				continue
+			}
+			for i, item := range items {
+				u.validate(r, p.params, itemScope(item, i, len(items)), fmt.Sprintf("%s[%d].", keyPath, i))
+			}
+		case MapParam:
+			entries, ok := mapParams(v)
+			if !ok {
+				r.Error("param \"%s\" should be a map with string keys, got: %T", keyPath, v)
+				continue
+			}
+			for i, entry := range entries {
+				u.validate(r, p.params, itemScope(entry, i, len(entries)), fmt.Sprintf("%s[%s].", keyPath, entry.(mapEntry).key))
+			}
+		case InjectionParam:
+			if !isParams(v) {
+				r.Error("param \"%s\" should be a map or a struct with template name and params, got: %T", keyPath, v)
+				continue
+			}
+			_tn, exists := lookupParam(v, "name")
+			if !exists {
+				r.Error("param \"%s.name\" not provided", keyPath)
+				continue
+			}
+			if _, lazy := _tn.(LazyParam); lazy {
+				continue
+			}
+			tn, ok := _tn.(string)
+			if !ok {
+				r.Error("param \"%s.name\" should be a string, got: %T", keyPath, _tn)
+				continue
+			}
+			if !allowedTemplate(p.allowed, tn) {
+				r.Error("param \"%s.name\": template \"%s\" is not allowed", keyPath, tn)
+				continue
+			}
+			t, exists := u.templates[tn]
+			if !exists {
+				r.Error("param \"%s.name\": template \"%s\" doesn't exist", keyPath, tn)
+				continue
+			}
+			injParams, exists := lookupParam(v, "params")
+			if !exists {
+				r.Error("param \"%s.params\" not provided", keyPath)
+				continue
+			}
+			if _, lazy := injParams.(LazyParam); lazy {
+				continue
+			}
+			if !isParams(injParams) {
+				r.Error("param \"%s.params\" should be a map or a struct, got: %T", keyPath, injParams)
+				continue
+			}
+			u.validate(r, t.params, withFallbacks(injParams, t.props), keyPath+".params.")
+		}
+	}
+}
+
+// returns schema entries of the single params level: inline templates are expanded and duplicates are skipped.
+func (u *Universe) flattenParams(params []param, inlined map[string]bool, flat []param) []param {
+nextParam:
+	for _, p := range params {
+		if p.kind == inlineParam {
+			t, exists := u.templates[p.template]
+			if !exists || inlined[t.name] {
+				continue
+			}
+			inlined[t.name] = true
+			start := len(flat)
+			flat = u.flattenParams(t.params, inlined, flat)
+			for i := start; i < len(flat); i++ {
+				_, static := p.props[flat[i].key]
+				_, prop := t.props[flat[i].key]
+				flat[i].optional = flat[i].optional || static || prop
+			}
+			continue
+		}
+		for _, existing := range flat {
+			if p.kind != ConditionParam && p.kind != SwitchParam && existing.key == p.key && existing.kind == p.kind {
+				continue nextParam
+			}
+		}
+		flat = append(flat, p)
+	}
+	return flat
+}
@@ -0,0 +1,135 @@
+package gt_test
+
+import (
+	. "github.com/Contra-Culture/gt"
+	"github.com/Contra-Culture/report"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("schema", func() {
+	It("describes params of the compiled templates", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("h1", Attributes(), Content(TextInj("title"))),
+				Repeat("articles", TemplatePlacement("/article", Auto())),
+				TemplatePlacement("/footer", Auto()),
+				TemplateInjection("bottom")))
+		limbo.Template(
+			"/article",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a",
+					Attributes(AttrInjection("href", "link")),
+					Content(TextInj("title"))),
+				TemplatePlacement("/author", "author"),
+				Variant("/empty", map[string]string{"related": "/article"})))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(TextInj("name")))
+		limbo.Template(
+			"/footer",
+			WithStylesheet("main"),
+			WithContent(TextInj("copyright")))
+		limbo.Template(
+			"/empty",
+			WithStylesheet("main"),
+			WithContent(Text("nothing related")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		_, exists := univ.Schema("/unknown")
+		Expect(exists).To(BeFalse())
+		schema, exists := univ.Schema("/page")
+		Expect(exists).To(BeTrue())
+		Expect(schema).To(Equal(&Schema{
+			Template: "/page",
+			Params: []Param{
+				{Key: "title", Kind: TextParam},
+				{
+					Key:  "articles",
+					Kind: ListParam,
+					Schema: &Schema{
+						Template: "/article",
+						Params: []Param{
+							{Key: "link", Kind: AttrParam},
+							{Key: "title", Kind: TextParam},
+							{
+								Key:  "author",
+								Kind: NestedParam,
+								Schema: &Schema{
+									Template: "/author",
+									Params:   []Param{{Key: "name", Kind: TextParam}},
+								},
+							},
+							{
+								Key:      "related",
+								Kind:     VariantParam,
+								Schema:   &Schema{Template: "/article", Recursive: true},
+								Optional: true,
+							},
+						},
+					},
+				},
+				{Key: "copyright", Kind: TextParam},
+				{Key: "bottom", Kind: InjectionParam},
+			},
+		}))
+	})
+	It("validates params against the template schema", func() {
+		limbo := newLimbo()
+		limbo.Template(
+			"/page",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("h1", Attributes(), Content(TextInj("title"))),
+				Repeat("articles", TemplatePlacement("/article", Auto())),
+				TemplateInjection("bottom")))
+		limbo.Template(
+			"/article",
+			WithStylesheet("main"),
+			WithContent(
+				Tag("a",
+					Attributes(AttrInjection("href", "link")),
+					Content(TextInj("title"))),
+				TemplatePlacement("/author", "author")))
+		limbo.Template(
+			"/author",
+			WithStylesheet("main"),
+			WithContent(TextInj("name")))
+		univ, r := limbo.Universe()
+		Expect(r.HasErrors()).To(BeFalse())
+		r = univ.Validate("/page", map[string]interface{}{
+			"title": "Articles",
+			"articles": []map[string]interface{}{
+				{"title": "First", "link": "/1", "author": map[string]interface{}{"name": "Sam"}},
+			},
+			"bottom": map[string]interface{}{
+				"name":   "/author",
+				"params": map[string]interface{}{"name": "John"},
+			},
+		})
+		Expect(r.HasErrors()).To(BeFalse())
+		r = univ.Validate("/page", map[string]interface{}{
+			"title": []int{1},
+			"articles": []map[string]interface{}{
+				{"title": "First", "author": map[string]interface{}{}},
+				{"title": "Second", "link": "/2", "author": "Sam"},
+			},
+			"bottom": map[string]interface{}{
+				"name":   "/unknown",
+				"params": map[string]interface{}{},
+			},
+		})
+		Expect(r.HasErrors()).To(BeTrue())
+		Expect(report.ToString(r)).To(And(
+			ContainSubstring("param \"title\" should be a string, number, boolean, time.Time, fmt.Stringer or encoding.TextMarshaler, got: []int"),
+			ContainSubstring("param \"articles[0].link\" not provided"),
+			ContainSubstring("param \"articles[0].author.name\" not provided"),
+			ContainSubstring("param \"articles[1].author\" should be a map or a struct, got: string"),
+			ContainSubstring("param \"bottom.name\": template \"/unknown\" doesn't exist")))
+	})
+})